@@ -18,14 +18,14 @@ func (sc *ServerConn) handleAOMsg(aoMsg mt.AOMsg) {
 		sc.swapAOID(&msg.Attach.ParentID)
 	case *mt.AOCmdProps:
 		for j := range msg.Props.Textures {
-			prependTexture(sc.mediaPool, &msg.Props.Textures[j])
+			prependTexture(sc.prefixer(), &msg.Props.Textures[j])
 		}
-		prepend(sc.mediaPool, &msg.Props.Mesh)
-		prepend(sc.mediaPool, &msg.Props.Itemstring)
-		prependTexture(sc.mediaPool, &msg.Props.DmgTextureMod)
+		prepend(sc.prefixer(), &msg.Props.Mesh)
+		prependItemString(sc.prefixer(), &msg.Props.Itemstring)
+		prependTexture(sc.prefixer(), &msg.Props.DmgTextureMod)
 	case *mt.AOCmdSpawnInfant:
 		sc.swapAOID(&msg.ID)
 	case *mt.AOCmdTextureMod:
-		prependTexture(sc.mediaPool, &msg.Mod)
+		prependTexture(sc.prefixer(), &msg.Mod)
 	}
 }
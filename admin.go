@@ -0,0 +1,475 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminCmdsLoaded holds the names of the builtin admin commands
+// that have been registered successfully.
+var adminCmdsLoaded = make(map[string]struct{})
+var adminCmdsMu sync.Mutex
+
+// AdminCmds returns the builtin admin commands.
+// Whether they are registered depends on
+// the NoAdminCmds and DisableAdminCmds config options.
+func AdminCmds() []ChatCmd {
+	return []ChatCmd{
+		{
+			Name: "server",
+			Perm: "cmd_server",
+			Help: "Show your current server or connect to another server.",
+			Args: []ChatCmdArg{
+				{Name: "name", Type: ServerArg, Optional: true},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if len(args) == 0 {
+					return "You are connected to " + cc.ServerName() + "."
+				}
+
+				if err := cc.Hop(args[0]); err != nil {
+					return "Could not switch servers. Error: " + err.Error()
+				}
+
+				return ""
+			},
+		},
+		{
+			Name: "gserver",
+			Perm: "cmd_gserver",
+			Help: "Connect to a server of a server group.",
+			Args: []ChatCmdArg{
+				{Name: "group"},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if err := cc.HopGroup(args[0]); err != nil {
+					return "Could not switch servers. Error: " + err.Error()
+				}
+
+				return ""
+			},
+		},
+		{
+			Name: "servers",
+			Perm: "cmd_servers",
+			Help: "List all servers and their player counts.",
+			Args: []ChatCmdArg{},
+			Handler: func(cc *ClientConn, args ...string) string {
+				counts := make(map[string]int)
+				for clt := range Clts() {
+					counts[clt.ServerName()]++
+				}
+
+				var names []string
+				for name := range Conf().Servers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				var b strings.Builder
+				b.WriteString("Servers:")
+				for _, name := range names {
+					fmt.Fprintf(&b, "\n%s (%d players)", name, counts[name])
+				}
+
+				return b.String()
+			},
+		},
+		{
+			Name: "who",
+			Perm: "cmd_who",
+			Help: "List all players or the players on a server.",
+			Args: []ChatCmdArg{
+				{Name: "server", Type: ServerArg, Optional: true},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				var names []string
+				for clt := range Clts() {
+					if clt.Name() == "" {
+						continue
+					}
+
+					if len(args) == 0 || clt.ServerName() == args[0] {
+						names = append(names, clt.Name())
+					}
+				}
+				sort.Strings(names)
+
+				if len(names) == 0 {
+					return "No players."
+				}
+
+				return fmt.Sprintf("%d players: %s", len(names), strings.Join(names, ", "))
+			},
+		},
+		{
+			Name: "find",
+			Perm: "cmd_find",
+			Help: "Show the server a player is connected to.",
+			Args: []ChatCmdArg{
+				{Name: "player", Type: PlayerArg},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				clt := Find(args[0])
+				if clt == nil {
+					return "Player " + args[0] + " is not connected."
+				}
+
+				return clt.Name() + " is connected to " + clt.ServerName() + "."
+			},
+		},
+		{
+			Name: "kick",
+			Perm: "cmd_kick",
+			Help: "Disconnect a player.",
+			Args: []ChatCmdArg{
+				{Name: "player", Type: PlayerArg},
+				{Name: "reason", Optional: true, Variadic: true},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				clt := Find(args[0])
+				if clt == nil {
+					return "Player " + args[0] + " is not connected."
+				}
+
+				reason := "Kicked by proxy."
+				if len(args) > 1 {
+					reason = strings.Join(args[1:], " ")
+				}
+
+				clt.Log("<-", "kicked by", cc.Name())
+				clt.Kick(reason)
+				return "Kicked " + clt.Name() + "."
+			},
+		},
+		{
+			Name: "ban",
+			Perm: "cmd_ban",
+			Help: "Disconnect a player and prevent their network address from connecting again.",
+			Args: []ChatCmdArg{
+				{Name: "player", Type: PlayerArg},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				clt := Find(args[0])
+				if clt == nil {
+					return "Player " + args[0] + " is not connected."
+				}
+
+				clt.Log("<-", "banned by", cc.Name())
+				if err := clt.Ban(); err != nil {
+					return "Could not ban. Error: " + err.Error()
+				}
+
+				return "Banned " + clt.Name() + "."
+			},
+		},
+		{
+			Name: "unban",
+			Perm: "cmd_unban",
+			Help: "Remove a player name or network address from the ban list.",
+			Args: []ChatCmdArg{
+				{Name: "name | address"},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if err := Unban(args[0]); err != nil {
+					return "Could not unban. Error: " + err.Error()
+				}
+
+				return "Unbanned " + args[0] + "."
+			},
+		},
+		{
+			Name: "send",
+			Perm: "cmd_send",
+			Help: "Move a player to another server.",
+			Args: []ChatCmdArg{
+				{Name: "player", Type: PlayerArg},
+				{Name: "server", Type: ServerArg},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				clt := Find(args[0])
+				if clt == nil {
+					return "Player " + args[0] + " is not connected."
+				}
+
+				if err := clt.Hop(args[1]); err != nil {
+					return "Could not send " + clt.Name() + ". Error: " + err.Error()
+				}
+
+				return "Sent " + clt.Name() + " to " + args[1] + "."
+			},
+		},
+		{
+			Name: "alert",
+			Perm: "cmd_alert",
+			Help: "Send a message to all players.",
+			Args: []ChatCmdArg{
+				{Name: "message", Variadic: true},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				msg := Colorize("[ALERT]", "#F00") + " " + strings.Join(args, " ")
+				for clt := range Clts() {
+					clt.SendChatMsg(msg)
+				}
+
+				return ""
+			},
+		},
+		{
+			Name: "reload",
+			Perm: "cmd_reload",
+			Help: "Reload the configuration file.",
+			Args: []ChatCmdArg{},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if err := LoadConfig(); err != nil {
+					return "Could not reload the configuration. Error: " + err.Error()
+				}
+
+				loadAdminCmds()
+				for clt := range Clts() {
+					go clt.SyncPrivs()
+				}
+
+				return "Configuration updated."
+			},
+		},
+		{
+			Name: "flushcontent",
+			Perm: "cmd_flushcontent",
+			Help: "Discard the cached content so that it is fetched from the servers again on the next login.",
+			Args: []ChatCmdArg{},
+			Handler: func(cc *ClientConn, args ...string) string {
+				FlushContentCache()
+				return "Content cache flushed."
+			},
+		},
+		{
+			Name: "muxreport",
+			Perm: "cmd_muxreport",
+			Help: "Summarize how the content of the media pools was multiplexed and write a detailed report to a file.",
+			Args: []ChatCmdArg{},
+			Handler: func(cc *ClientConn, args ...string) string {
+				report := LastMuxReport()
+				if report == nil {
+					return "The content hasn't been fetched yet."
+				}
+
+				path, err := WriteMuxReport()
+				if err != nil {
+					return "Could not write report. Error: " + err.Error()
+				}
+
+				var pools []string
+				for pool := range report.Pools {
+					pools = append(pools, pool)
+				}
+				sort.Strings(pools)
+
+				var b strings.Builder
+				fmt.Fprintf(&b, "Content fetched at %s.", report.Time.Format(time.DateTime))
+				for _, pool := range pools {
+					pr := report.Pools[pool]
+					fmt.Fprintf(&b, "\n%s (%s): %d items, %d nodes, %d media", pool, pr.Server, pr.Items, pr.Nodes, pr.Media)
+				}
+
+				if len(report.FailedPools) > 0 {
+					fmt.Fprintf(&b, "\nFailed pools: %s", strings.Join(report.FailedPools, ", "))
+				}
+
+				fmt.Fprintf(&b, "\n%d name collisions, %d missing textures, %d shared conflicts, %d deduplicated media",
+					len(report.Collisions), len(report.MissingMedia), len(report.SharedConflicts), len(report.MediaAliases))
+				fmt.Fprintf(&b, "\nFull report written to %s.", path)
+
+				return b.String()
+			},
+		},
+		{
+			Name: "addserver",
+			Perm: "cmd_addserver",
+			Help: "Add a temporary server. It must share a media pool with an existing server.",
+			Args: []ChatCmdArg{
+				{Name: "name"},
+				{Name: "address"},
+				{Name: "pool"},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if !AddServer(args[0], Server{
+					Addr:      args[1],
+					MediaPool: args[2],
+				}) {
+					return "Could not add server " + args[0] + "."
+				}
+
+				return "Added server " + args[0] + "."
+			},
+		},
+		{
+			Name: "rmserver",
+			Perm: "cmd_rmserver",
+			Help: "Remove a temporary server that has no players.",
+			Args: []ChatCmdArg{
+				{Name: "name"},
+			},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if !RmServer(args[0]) {
+					return "Could not remove server " + args[0] + "."
+				}
+
+				return "Removed server " + args[0] + "."
+			},
+		},
+		{
+			Name: "perms",
+			Perm: "cmd_perms",
+			Help: "Manage the permission groups and permissions of players.",
+			SubCmds: []ChatCmd{
+				{
+					Name: "show",
+					Help: "Show the groups and permissions of a player.",
+					Args: []ChatCmdArg{
+						{Name: "player"},
+					},
+					Handler: func(cc *ClientConn, args ...string) string {
+						return "Groups: " + strings.Join(PlayerGroups(args[0]), ", ") +
+							"\nPermissions: " + strings.Join(PlayerPerms(args[0]), ", ")
+					},
+				},
+				{
+					Name: "addgroup",
+					Help: "Add a player to a group, optionally for a limited time (e.g. 24h).",
+					Args: []ChatCmdArg{
+						{Name: "player"},
+						{Name: "group"},
+						{Name: "duration", Optional: true},
+					},
+					Handler: func(cc *ClientConn, args ...string) string {
+						d, err := optDuration(args, 2)
+						if err != nil {
+							return "Invalid duration. Error: " + err.Error()
+						}
+
+						if err := AddUserGroup(args[0], args[1], d); err != nil {
+							return "Could not add to group. Error: " + err.Error()
+						}
+
+						return "Added " + args[0] + " to " + args[1] + "."
+					},
+				},
+				{
+					Name: "rmgroup",
+					Help: "Remove a player from a group.",
+					Args: []ChatCmdArg{
+						{Name: "player"},
+						{Name: "group"},
+					},
+					Handler: func(cc *ClientConn, args ...string) string {
+						if err := RmUserGroup(args[0], args[1]); err != nil {
+							return "Could not remove from group. Error: " + err.Error()
+						}
+
+						return "Removed " + args[0] + " from " + args[1] + "."
+					},
+				},
+				{
+					Name: "grant",
+					Help: "Grant a permission to a player, optionally for a limited time (e.g. 24h).",
+					Args: []ChatCmdArg{
+						{Name: "player"},
+						{Name: "perm"},
+						{Name: "duration", Optional: true},
+					},
+					Handler: func(cc *ClientConn, args ...string) string {
+						d, err := optDuration(args, 2)
+						if err != nil {
+							return "Invalid duration. Error: " + err.Error()
+						}
+
+						if err := AddUserPerm(args[0], args[1], d); err != nil {
+							return "Could not grant permission. Error: " + err.Error()
+						}
+
+						return "Granted " + args[1] + " to " + args[0] + "."
+					},
+				},
+				{
+					Name: "revoke",
+					Help: "Revoke a permission granted using the grant subcommand.",
+					Args: []ChatCmdArg{
+						{Name: "player"},
+						{Name: "perm"},
+					},
+					Handler: func(cc *ClientConn, args ...string) string {
+						if err := RmUserPerm(args[0], args[1]); err != nil {
+							return "Could not revoke permission. Error: " + err.Error()
+						}
+
+						return "Revoked " + args[1] + " from " + args[0] + "."
+					},
+				},
+			},
+		},
+		{
+			Name: "uptime",
+			Perm: "cmd_uptime",
+			Help: "Show how long the proxy has been running for.",
+			Args: []ChatCmdArg{},
+			Handler: func(cc *ClientConn, args ...string) string {
+				return "Uptime: " + Uptime().Truncate(time.Second).String()
+			},
+		},
+	}
+}
+
+// optDuration parses the optional duration argument at index i.
+func optDuration(args []string, i int) (time.Duration, error) {
+	if len(args) <= i {
+		return 0, nil
+	}
+
+	return time.ParseDuration(args[i])
+}
+
+// loadAdminCmds registers the enabled builtin admin commands
+// and unregisters the disabled ones.
+// Commands that already exist, e.g. because a plugin
+// has registered them, are skipped.
+func loadAdminCmds() {
+	adminCmdsMu.Lock()
+	defer adminCmdsMu.Unlock()
+
+	conf := Conf()
+
+	disabled := make(map[string]struct{})
+	for _, name := range conf.DisableAdminCmds {
+		disabled[name] = struct{}{}
+	}
+
+	for _, cmd := range AdminCmds() {
+		_, loaded := adminCmdsLoaded[cmd.Name]
+		_, disable := disabled[cmd.Name]
+
+		if conf.NoAdminCmds || disable {
+			if loaded {
+				UnregisterChatCmd(cmd.Name)
+				delete(adminCmdsLoaded, cmd.Name)
+			}
+
+			continue
+		}
+
+		if loaded {
+			continue
+		}
+
+		if !RegisterChatCmd(cmd) {
+			log.Print("admin command ", cmd.Name, " already exists, skipping")
+			continue
+		}
+
+		adminCmdsLoaded[cmd.Name] = struct{}{}
+	}
+}
@@ -13,6 +13,9 @@ var (
 	ErrAuthBackendExists   = errors.New("auth backend already set")
 	ErrInvalidSRPHeader    = errors.New("encoded password is not SRP")
 	ErrLastSrvNotSupported = errors.New("auth backend does not support server information")
+	ErrNoStorageKey        = errors.New("storage key does not exist")
+	ErrInvalidStorageKey   = errors.New("invalid storage namespace, player or key")
+	ErrInvalidPlayerName   = errors.New("invalid player name")
 )
 
 type User struct {
@@ -27,12 +30,52 @@ type Ban struct {
 	Name string
 }
 
+// A LastSrvEntry records the last server a player was on.
+// Group is empty for the last server overall. Otherwise it is
+// the server group the last server within that group belongs to.
+type LastSrvEntry struct {
+	Name  string
+	Group string
+	Srv   string
+}
+
+// A UserGroup assigns a player to a permission group.
+// The assignment is ignored after the Expiry
+// unless it is the zero time.
+type UserGroup struct {
+	Name   string
+	Group  string
+	Expiry time.Time
+}
+
+// A UserPerm grants a permission to a player directly.
+// The grant is ignored after the Expiry
+// unless it is the zero time.
+type UserPerm struct {
+	Name   string
+	Perm   string
+	Expiry time.Time
+}
+
+// A StorageEntry is a key/value pair stored on behalf of a plugin.
+// Player is empty for global entries.
+type StorageEntry struct {
+	Namespace string
+	Player    string
+	Key       string
+	Value     string
+}
+
 type AuthBackend interface {
 	Exists(name string) bool
 	Passwd(name string) (salt, verifier []byte, err error)
 	SetPasswd(name string, salt, verifier []byte) error
 	LastSrv(name string) (string, error)
 	SetLastSrv(name, srv string) error
+	LastGroupSrv(name, group string) (string, error)
+	SetLastGroupSrv(name, group, srv string) error
+	ImportLastSrvs(in []LastSrvEntry) error
+	ExportLastSrvs() ([]LastSrvEntry, error)
 	Timestamp(name string) (time.Time, error)
 	Import(in []User) error
 	Export() ([]User, error)
@@ -42,6 +85,31 @@ type AuthBackend interface {
 	Banned(addr *net.UDPAddr) bool
 	ImportBans(in []Ban) error
 	ExportBans() ([]Ban, error)
+
+	AddWhitelist(name string) error
+	RmWhitelist(name string) error
+	Whitelisted(name string) bool
+	ImportWhitelist(in []string) error
+	ExportWhitelist() ([]string, error)
+
+	AddUserGroup(name, group string, expiry time.Time) error
+	RmUserGroup(name, group string) error
+	UserGroups(name string) ([]UserGroup, error)
+	ImportUserGroups(in []UserGroup) error
+	ExportUserGroups() ([]UserGroup, error)
+
+	AddUserPerm(name, perm string, expiry time.Time) error
+	RmUserPerm(name, perm string) error
+	UserPerms(name string) ([]UserPerm, error)
+	ImportUserPerms(in []UserPerm) error
+	ExportUserPerms() ([]UserPerm, error)
+
+	StorageGet(namespace, player, key string) (string, error)
+	StorageSet(namespace, player, key, value string) error
+	StorageRm(namespace, player, key string) error
+	StorageKeys(namespace, player string) ([]string, error)
+	ImportStorage(in []StorageEntry) error
+	ExportStorage() ([]StorageEntry, error)
 }
 
 func setAuthBackend(ab AuthBackend) error {
@@ -53,6 +121,20 @@ func setAuthBackend(ab AuthBackend) error {
 	return nil
 }
 
+// unixExpiry converts an expiry to a unix timestamp.
+// The zero time is represented as 0.
+func unixExpiry(expiry time.Time) int64 {
+	if expiry.IsZero() {
+		return 0
+	}
+
+	return expiry.Unix()
+}
+
+func validStorageName(s string) bool {
+	return s != "" && s != "." && s != ".."
+}
+
 func encodeVerifierAndSalt(salt, verifier []byte) string {
 	return "#1#" + b64.EncodeToString(salt) + "#" + b64.EncodeToString(verifier)
 }
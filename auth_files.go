@@ -2,7 +2,10 @@ package proxy
 
 import (
 	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -70,6 +73,91 @@ func (a AuthFiles) SetLastSrv(name, srv string) error {
 	return os.WriteFile(Path("auth/", name, "/last_server"), []byte(srv), 0600)
 }
 
+// LastGroupSrv returns the last server a user was on
+// within a server group.
+func (a AuthFiles) LastGroupSrv(name, group string) (string, error) {
+	os.Mkdir(Path("auth"), 0700)
+	os.Mkdir(Path("auth/", name), 0700)
+
+	srv, err := os.ReadFile(Path("auth/", name, "/last_group_server/", url.PathEscape(group)))
+	return string(srv), err
+}
+
+// SetLastGroupSrv sets the last server a user was on
+// within a server group.
+func (a AuthFiles) SetLastGroupSrv(name, group, srv string) error {
+	os.Mkdir(Path("auth"), 0700)
+	os.Mkdir(Path("auth/", name), 0700)
+	os.Mkdir(Path("auth/", name, "/last_group_server"), 0700)
+
+	return os.WriteFile(Path("auth/", name, "/last_group_server/", url.PathEscape(group)), []byte(srv), 0600)
+}
+
+// ImportLastSrvs sets the passed last servers.
+func (a AuthFiles) ImportLastSrvs(in []LastSrvEntry) error {
+	for _, e := range in {
+		var err error
+		if e.Group == "" {
+			err = a.SetLastSrv(e.Name, e.Srv)
+		} else {
+			err = a.SetLastGroupSrv(e.Name, e.Group, e.Srv)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportLastSrvs returns data that can be processed by ImportLastSrvs
+// or an error.
+func (a AuthFiles) ExportLastSrvs() ([]LastSrvEntry, error) {
+	os.Mkdir(Path("auth"), 0700)
+
+	dir, err := os.ReadDir(Path("auth"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []LastSrvEntry
+	for _, f := range dir {
+		// Skip plugin storage.
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		name := f.Name()
+		if srv, err := os.ReadFile(Path("auth/", name, "/last_server")); err == nil {
+			out = append(out, LastSrvEntry{
+				Name: name,
+				Srv:  string(srv),
+			})
+		}
+
+		groups, err := readStorageDir(Path("auth/", name, "/last_group_server"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groups {
+			srv, err := a.LastGroupSrv(name, group)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, LastSrvEntry{
+				Name:  name,
+				Group: group,
+				Srv:   srv,
+			})
+		}
+	}
+
+	return out, nil
+}
+
 // Timestamp returns the last time an authentication entry was accessed
 // or an error.
 func (a AuthFiles) Timestamp(name string) (time.Time, error) {
@@ -110,6 +198,11 @@ func (a AuthFiles) Export() ([]User, error) {
 
 	var out []User
 	for _, f := range dir {
+		// Skip plugin storage.
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
 		u := User{Name: f.Name()}
 
 		u.Timestamp, err = a.Timestamp(u.Name)
@@ -214,6 +307,482 @@ func (a AuthFiles) ExportBans() ([]Ban, error) {
 	return out, nil
 }
 
+// AddWhitelist adds a player to the whitelist.
+func (a AuthFiles) AddWhitelist(name string) error {
+	if !playerNameChars.MatchString(name) {
+		return ErrInvalidPlayerName
+	}
+
+	os.Mkdir(Path("whitelist"), 0700)
+	return os.WriteFile(Path("whitelist/", name), []byte{}, 0600)
+}
+
+// RmWhitelist removes a player from the whitelist.
+// It is not an error if the player isn't whitelisted.
+func (a AuthFiles) RmWhitelist(name string) error {
+	if !playerNameChars.MatchString(name) {
+		return ErrInvalidPlayerName
+	}
+
+	os.Mkdir(Path("whitelist"), 0700)
+
+	if err := os.Remove(Path("whitelist/", name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Whitelisted reports whether a player is whitelisted.
+// Error cases count as not whitelisted.
+func (a AuthFiles) Whitelisted(name string) bool {
+	if !playerNameChars.MatchString(name) {
+		return false
+	}
+
+	os.Mkdir(Path("whitelist"), 0700)
+
+	_, err := os.Stat(Path("whitelist/", name))
+	return err == nil
+}
+
+// ImportWhitelist adds the passed players to the whitelist.
+func (a AuthFiles) ImportWhitelist(in []string) error {
+	for _, name := range in {
+		if err := a.AddWhitelist(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportWhitelist returns data that can be processed by ImportWhitelist
+// or an error.
+func (a AuthFiles) ExportWhitelist() ([]string, error) {
+	os.Mkdir(Path("whitelist"), 0700)
+
+	dir, err := os.ReadDir(Path("whitelist"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, f := range dir {
+		out = append(out, f.Name())
+	}
+
+	return out, nil
+}
+
+// AddUserGroup adds a player to a permission group.
+// An existing assignment is replaced.
+// A zero expiry means that the assignment never expires.
+func (a AuthFiles) AddUserGroup(name, group string, expiry time.Time) error {
+	return a.addGrant("groups", name, group, expiry)
+}
+
+// RmUserGroup removes a player from a permission group.
+// It is not an error if the player isn't a member of the group.
+func (a AuthFiles) RmUserGroup(name, group string) error {
+	return a.rmGrant("groups", name, group)
+}
+
+// UserGroups returns the permission groups of a player
+// including expired ones.
+func (a AuthFiles) UserGroups(name string) ([]UserGroup, error) {
+	grants, err := a.readGrants("groups", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []UserGroup
+	for _, g := range grants {
+		out = append(out, UserGroup{
+			Name:   name,
+			Group:  g.value,
+			Expiry: g.expiry,
+		})
+	}
+
+	return out, nil
+}
+
+// ImportUserGroups adds the passed group assignments.
+func (a AuthFiles) ImportUserGroups(in []UserGroup) error {
+	for _, g := range in {
+		if err := a.AddUserGroup(g.Name, g.Group, g.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserGroups returns data that can be processed by ImportUserGroups
+// or an error.
+func (a AuthFiles) ExportUserGroups() ([]UserGroup, error) {
+	os.Mkdir(Path("groups"), 0700)
+
+	dir, err := os.ReadDir(Path("groups"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []UserGroup
+	for _, f := range dir {
+		groups, err := a.UserGroups(f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, groups...)
+	}
+
+	return out, nil
+}
+
+// AddUserPerm grants a permission to a player.
+// An existing grant is replaced.
+// A zero expiry means that the grant never expires.
+func (a AuthFiles) AddUserPerm(name, perm string, expiry time.Time) error {
+	return a.addGrant("perms", name, perm, expiry)
+}
+
+// RmUserPerm revokes a permission granted by AddUserPerm.
+// It is not an error if the permission hasn't been granted.
+func (a AuthFiles) RmUserPerm(name, perm string) error {
+	return a.rmGrant("perms", name, perm)
+}
+
+// UserPerms returns the permissions granted to a player directly
+// including expired ones.
+func (a AuthFiles) UserPerms(name string) ([]UserPerm, error) {
+	grants, err := a.readGrants("perms", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []UserPerm
+	for _, g := range grants {
+		out = append(out, UserPerm{
+			Name:   name,
+			Perm:   g.value,
+			Expiry: g.expiry,
+		})
+	}
+
+	return out, nil
+}
+
+// ImportUserPerms adds the passed permission grants.
+func (a AuthFiles) ImportUserPerms(in []UserPerm) error {
+	for _, p := range in {
+		if err := a.AddUserPerm(p.Name, p.Perm, p.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserPerms returns data that can be processed by ImportUserPerms
+// or an error.
+func (a AuthFiles) ExportUserPerms() ([]UserPerm, error) {
+	os.Mkdir(Path("perms"), 0700)
+
+	dir, err := os.ReadDir(Path("perms"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []UserPerm
+	for _, f := range dir {
+		perms, err := a.UserPerms(f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, perms...)
+	}
+
+	return out, nil
+}
+
+type grant struct {
+	value  string
+	expiry time.Time
+}
+
+// readGrants parses the grant file of a player.
+// Each line consists of the granted value
+// and the expiry as a unix timestamp or 0.
+func (a AuthFiles) readGrants(dir, name string) ([]grant, error) {
+	if !playerNameChars.MatchString(name) {
+		return nil, ErrInvalidPlayerName
+	}
+
+	os.Mkdir(Path(dir), 0700)
+
+	data, err := os.ReadFile(Path(dir, "/", name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var grants []grant
+	for _, line := range strings.Split(string(data), "\n") {
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		g := grant{value: line[:i]}
+		if expiry != 0 {
+			g.expiry = time.Unix(expiry, 0)
+		}
+
+		grants = append(grants, g)
+	}
+
+	return grants, nil
+}
+
+func (a AuthFiles) writeGrants(dir, name string, grants []grant) error {
+	if !playerNameChars.MatchString(name) {
+		return ErrInvalidPlayerName
+	}
+
+	os.Mkdir(Path(dir), 0700)
+
+	if len(grants) == 0 {
+		if err := os.Remove(Path(dir, "/", name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	var b strings.Builder
+	for _, g := range grants {
+		b.WriteString(g.value + " " + strconv.FormatInt(unixExpiry(g.expiry), 10) + "\n")
+	}
+
+	return os.WriteFile(Path(dir, "/", name), []byte(b.String()), 0600)
+}
+
+func (a AuthFiles) addGrant(dir, name, value string, expiry time.Time) error {
+	grants, err := a.readGrants(dir, name)
+	if err != nil {
+		return err
+	}
+
+	for i, g := range grants {
+		if g.value == value {
+			grants[i].expiry = expiry
+			return a.writeGrants(dir, name, grants)
+		}
+	}
+
+	return a.writeGrants(dir, name, append(grants, grant{value, expiry}))
+}
+
+func (a AuthFiles) rmGrant(dir, name, value string) error {
+	grants, err := a.readGrants(dir, name)
+	if err != nil {
+		return err
+	}
+
+	for i, g := range grants {
+		if g.value == value {
+			return a.writeGrants(dir, name, append(grants[:i], grants[i+1:]...))
+		}
+	}
+
+	return nil
+}
+
+// StorageGet returns the value of a plugin storage key.
+// The player is empty for global keys.
+func (a AuthFiles) StorageGet(namespace, player, key string) (string, error) {
+	dir, err := a.storageDir(namespace, player)
+	if err != nil {
+		return "", err
+	}
+
+	if !validStorageName(key) {
+		return "", ErrInvalidStorageKey
+	}
+
+	value, err := os.ReadFile(dir + "/" + url.PathEscape(key))
+	if os.IsNotExist(err) {
+		return "", ErrNoStorageKey
+	}
+
+	return string(value), err
+}
+
+// StorageSet sets the value of a plugin storage key,
+// creating it if necessary.
+func (a AuthFiles) StorageSet(namespace, player, key, value string) error {
+	dir, err := a.storageDir(namespace, player)
+	if err != nil {
+		return err
+	}
+
+	if !validStorageName(key) {
+		return ErrInvalidStorageKey
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dir+"/"+url.PathEscape(key), []byte(value), 0600)
+}
+
+// StorageRm deletes a plugin storage key.
+// It is not an error if the key doesn't exist.
+func (a AuthFiles) StorageRm(namespace, player, key string) error {
+	dir, err := a.storageDir(namespace, player)
+	if err != nil {
+		return err
+	}
+
+	if !validStorageName(key) {
+		return ErrInvalidStorageKey
+	}
+
+	if err := os.Remove(dir + "/" + url.PathEscape(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// StorageKeys returns all keys of a plugin storage namespace
+// for the player or the global keys if the player is empty.
+func (a AuthFiles) StorageKeys(namespace, player string) ([]string, error) {
+	dir, err := a.storageDir(namespace, player)
+	if err != nil {
+		return nil, err
+	}
+
+	return readStorageDir(dir)
+}
+
+// ImportStorage adds the passed plugin storage entries.
+func (a AuthFiles) ImportStorage(in []StorageEntry) error {
+	for _, e := range in {
+		if err := a.StorageSet(e.Namespace, e.Player, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportStorage returns data that can be processed by ImportStorage
+// or an error.
+func (a AuthFiles) ExportStorage() ([]StorageEntry, error) {
+	namespaces, err := readStorageDir(Path("auth/.storage"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []StorageEntry
+	export := func(namespace, player string) error {
+		keys, err := a.StorageKeys(namespace, player)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			value, err := a.StorageGet(namespace, player, key)
+			if err != nil {
+				return err
+			}
+
+			out = append(out, StorageEntry{
+				Namespace: namespace,
+				Player:    player,
+				Key:       key,
+				Value:     value,
+			})
+		}
+
+		return nil
+	}
+
+	for _, namespace := range namespaces {
+		if err := export(namespace, ""); err != nil {
+			return nil, err
+		}
+
+		players, err := readStorageDir(Path("auth/.storage/", url.PathEscape(namespace), "/player"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, player := range players {
+			if err := export(namespace, player); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (a AuthFiles) storageDir(namespace, player string) (string, error) {
+	if !validStorageName(namespace) {
+		return "", ErrInvalidStorageKey
+	}
+
+	if player == "" {
+		return Path("auth/.storage/", url.PathEscape(namespace), "/global"), nil
+	}
+
+	if !validStorageName(player) {
+		return "", ErrInvalidStorageKey
+	}
+
+	return Path("auth/.storage/", url.PathEscape(namespace), "/player/", url.PathEscape(player)), nil
+}
+
+// readStorageDir returns the unescaped names of the entries of a directory.
+// A missing directory is treated as empty.
+func readStorageDir(path string) ([]string, error) {
+	dir, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range dir {
+		name, err := url.PathUnescape(f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
 func (a AuthFiles) updateTimestamp(name string) {
 	os.Mkdir(Path("auth"), 0700)
 
@@ -93,6 +93,31 @@ func NewAuthMTPostgreSQL(conn string) (*AuthMTPostgreSQL, error) {
 		return nil, err
 	}
 
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS public.whitelist (name text PRIMARY KEY);"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS public.last_server (name text NOT NULL, grp text NOT NULL, server text NOT NULL, PRIMARY KEY (name, grp));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS public.user_groups (name text NOT NULL, grp text NOT NULL, expiry bigint NOT NULL, PRIMARY KEY (name, grp));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS public.user_perms (name text NOT NULL, perm text NOT NULL, expiry bigint NOT NULL, PRIMARY KEY (name, perm));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS public.storage (namespace text NOT NULL, player text NOT NULL, key text NOT NULL, value text NOT NULL, PRIMARY KEY (namespace, player, key));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &AuthMTPostgreSQL{db}, nil
 }
 
@@ -138,18 +163,72 @@ func (a *AuthMTPostgreSQL) SetPasswd(name string, salt, verifier []byte) error {
 	return err
 }
 
-// LastSrv always returns an error
-// since the Minetest database schema cannot store this information.
-func (a *AuthMTPostgreSQL) LastSrv(_ string) (string, error) {
-	return "", ErrLastSrvNotSupported
+// LastSrv returns the last server a user was on.
+// It is stored in a separate table that is not part
+// of the Minetest database schema.
+func (a *AuthMTPostgreSQL) LastSrv(name string) (string, error) {
+	return a.LastGroupSrv(name, "")
+}
+
+// SetLastSrv sets the last server a user was on.
+func (a *AuthMTPostgreSQL) SetLastSrv(name, srv string) error {
+	return a.SetLastGroupSrv(name, "", srv)
+}
+
+// LastGroupSrv returns the last server a user was on
+// within a server group.
+func (a *AuthMTPostgreSQL) LastGroupSrv(name, group string) (string, error) {
+	result := a.db.QueryRow("SELECT server FROM last_server WHERE name = $1 AND grp = $2;", name, group)
+
+	var srv string
+	err := result.Scan(&srv)
+	return srv, err
+}
+
+// SetLastGroupSrv sets the last server a user was on
+// within a server group.
+func (a *AuthMTPostgreSQL) SetLastGroupSrv(name, group, srv string) error {
+	_, err := a.db.Exec("INSERT INTO last_server (name, grp, server) VALUES ($1, $2, $3) ON CONFLICT (name, grp) DO UPDATE SET server = EXCLUDED.server;", name, group, srv)
+	return err
 }
 
-// SetLastSrv is a no-op
-// since the Minetest database schema cannot store this information.
-func (a *AuthMTPostgreSQL) SetLastSrv(_, _ string) error {
+// ImportLastSrvs sets the passed last servers.
+func (a *AuthMTPostgreSQL) ImportLastSrvs(in []LastSrvEntry) error {
+	for _, e := range in {
+		if err := a.SetLastGroupSrv(e.Name, e.Group, e.Srv); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ExportLastSrvs returns data that can be processed by ImportLastSrvs
+// or an error.
+func (a *AuthMTPostgreSQL) ExportLastSrvs() ([]LastSrvEntry, error) {
+	result, err := a.db.Query("SELECT name, grp, server FROM last_server;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []LastSrvEntry
+	for result.Next() {
+		var e LastSrvEntry
+		if err := result.Scan(&e.Name, &e.Group, &e.Srv); err != nil {
+			return nil, err
+		}
+
+		out = append(out, e)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // Timestamp returns the last time an authentication entry was accessed
 // or an error.
 func (a *AuthMTPostgreSQL) Timestamp(name string) (time.Time, error) {
@@ -301,6 +380,301 @@ func (a *AuthMTPostgreSQL) ExportBans() ([]Ban, error) {
 	return unmapped, nil
 }
 
+// AddWhitelist adds a player to the whitelist.
+func (a *AuthMTPostgreSQL) AddWhitelist(name string) error {
+	_, err := a.db.Exec("INSERT INTO whitelist (name) VALUES ($1) ON CONFLICT (name) DO NOTHING;", name)
+	return err
+}
+
+// RmWhitelist removes a player from the whitelist.
+// It is not an error if the player isn't whitelisted.
+func (a *AuthMTPostgreSQL) RmWhitelist(name string) error {
+	_, err := a.db.Exec("DELETE FROM whitelist WHERE name = $1;", name)
+	return err
+}
+
+// Whitelisted reports whether a player is whitelisted.
+// Error cases count as not whitelisted.
+func (a *AuthMTPostgreSQL) Whitelisted(name string) bool {
+	result := a.db.QueryRow("SELECT COUNT(1) FROM whitelist WHERE name = $1;", name)
+
+	var count int
+	if err := result.Scan(&count); err != nil {
+		return false
+	}
+
+	return count == 1
+}
+
+// ImportWhitelist adds the passed players to the whitelist.
+func (a *AuthMTPostgreSQL) ImportWhitelist(in []string) error {
+	for _, name := range in {
+		if err := a.AddWhitelist(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportWhitelist returns data that can be processed by ImportWhitelist
+// or an error.
+func (a *AuthMTPostgreSQL) ExportWhitelist() ([]string, error) {
+	result, err := a.db.Query("SELECT name FROM whitelist;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []string
+	for result.Next() {
+		var name string
+		if err := result.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		out = append(out, name)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// AddUserGroup adds a player to a permission group.
+// An existing assignment is replaced.
+// A zero expiry means that the assignment never expires.
+func (a *AuthMTPostgreSQL) AddUserGroup(name, group string, expiry time.Time) error {
+	_, err := a.db.Exec("INSERT INTO user_groups (name, grp, expiry) VALUES ($1, $2, $3) ON CONFLICT (name, grp) DO UPDATE SET expiry = EXCLUDED.expiry;", name, group, unixExpiry(expiry))
+	return err
+}
+
+// RmUserGroup removes a player from a permission group.
+// It is not an error if the player isn't a member of the group.
+func (a *AuthMTPostgreSQL) RmUserGroup(name, group string) error {
+	_, err := a.db.Exec("DELETE FROM user_groups WHERE name = $1 AND grp = $2;", name, group)
+	return err
+}
+
+// UserGroups returns the permission groups of a player
+// including expired ones.
+func (a *AuthMTPostgreSQL) UserGroups(name string) ([]UserGroup, error) {
+	return a.queryUserGroups("SELECT name, grp, expiry FROM user_groups WHERE name = $1;", name)
+}
+
+// ImportUserGroups adds the passed group assignments.
+func (a *AuthMTPostgreSQL) ImportUserGroups(in []UserGroup) error {
+	for _, x := range in {
+		if err := a.AddUserGroup(x.Name, x.Group, x.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserGroups returns data that can be processed by ImportUserGroups
+// or an error.
+func (a *AuthMTPostgreSQL) ExportUserGroups() ([]UserGroup, error) {
+	return a.queryUserGroups("SELECT name, grp, expiry FROM user_groups;")
+}
+
+func (a *AuthMTPostgreSQL) queryUserGroups(query string, args ...interface{}) ([]UserGroup, error) {
+	result, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []UserGroup
+	for result.Next() {
+		var x UserGroup
+		var expiry int64
+		if err := result.Scan(&x.Name, &x.Group, &expiry); err != nil {
+			return nil, err
+		}
+
+		if expiry != 0 {
+			x.Expiry = time.Unix(expiry, 0)
+		}
+
+		out = append(out, x)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// AddUserPerm grants a permission to a player.
+// An existing grant is replaced.
+// A zero expiry means that the grant never expires.
+func (a *AuthMTPostgreSQL) AddUserPerm(name, perm string, expiry time.Time) error {
+	_, err := a.db.Exec("INSERT INTO user_perms (name, perm, expiry) VALUES ($1, $2, $3) ON CONFLICT (name, perm) DO UPDATE SET expiry = EXCLUDED.expiry;", name, perm, unixExpiry(expiry))
+	return err
+}
+
+// RmUserPerm revokes a permission granted by AddUserPerm.
+// It is not an error if the permission hasn't been granted.
+func (a *AuthMTPostgreSQL) RmUserPerm(name, perm string) error {
+	_, err := a.db.Exec("DELETE FROM user_perms WHERE name = $1 AND perm = $2;", name, perm)
+	return err
+}
+
+// UserPerms returns the permissions granted to a player directly
+// including expired ones.
+func (a *AuthMTPostgreSQL) UserPerms(name string) ([]UserPerm, error) {
+	return a.queryUserPerms("SELECT name, perm, expiry FROM user_perms WHERE name = $1;", name)
+}
+
+// ImportUserPerms adds the passed permission grants.
+func (a *AuthMTPostgreSQL) ImportUserPerms(in []UserPerm) error {
+	for _, x := range in {
+		if err := a.AddUserPerm(x.Name, x.Perm, x.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserPerms returns data that can be processed by ImportUserPerms
+// or an error.
+func (a *AuthMTPostgreSQL) ExportUserPerms() ([]UserPerm, error) {
+	return a.queryUserPerms("SELECT name, perm, expiry FROM user_perms;")
+}
+
+func (a *AuthMTPostgreSQL) queryUserPerms(query string, args ...interface{}) ([]UserPerm, error) {
+	result, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []UserPerm
+	for result.Next() {
+		var x UserPerm
+		var expiry int64
+		if err := result.Scan(&x.Name, &x.Perm, &expiry); err != nil {
+			return nil, err
+		}
+
+		if expiry != 0 {
+			x.Expiry = time.Unix(expiry, 0)
+		}
+
+		out = append(out, x)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// StorageGet returns the value of a plugin storage key.
+// The player is empty for global keys.
+func (a *AuthMTPostgreSQL) StorageGet(namespace, player, key string) (string, error) {
+	result := a.db.QueryRow("SELECT value FROM storage WHERE namespace = $1 AND player = $2 AND key = $3;", namespace, player, key)
+
+	var value string
+	if err := result.Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoStorageKey
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
+
+// StorageSet sets the value of a plugin storage key,
+// creating it if necessary.
+func (a *AuthMTPostgreSQL) StorageSet(namespace, player, key, value string) error {
+	if !validStorageName(namespace) || !validStorageName(key) {
+		return ErrInvalidStorageKey
+	}
+
+	_, err := a.db.Exec("INSERT INTO storage (namespace, player, key, value) VALUES ($1, $2, $3, $4) ON CONFLICT (namespace, player, key) DO UPDATE SET value = EXCLUDED.value;", namespace, player, key, value)
+	return err
+}
+
+// StorageRm deletes a plugin storage key.
+// It is not an error if the key doesn't exist.
+func (a *AuthMTPostgreSQL) StorageRm(namespace, player, key string) error {
+	_, err := a.db.Exec("DELETE FROM storage WHERE namespace = $1 AND player = $2 AND key = $3;", namespace, player, key)
+	return err
+}
+
+// StorageKeys returns all keys of a plugin storage namespace
+// for the player or the global keys if the player is empty.
+func (a *AuthMTPostgreSQL) StorageKeys(namespace, player string) ([]string, error) {
+	result, err := a.db.Query("SELECT key FROM storage WHERE namespace = $1 AND player = $2;", namespace, player)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var keys []string
+	for result.Next() {
+		var key string
+		if err := result.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ImportStorage adds the passed plugin storage entries.
+func (a *AuthMTPostgreSQL) ImportStorage(in []StorageEntry) error {
+	for _, e := range in {
+		if err := a.StorageSet(e.Namespace, e.Player, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportStorage returns data that can be processed by ImportStorage
+// or an error.
+func (a *AuthMTPostgreSQL) ExportStorage() ([]StorageEntry, error) {
+	result, err := a.db.Query("SELECT namespace, player, key, value FROM storage;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []StorageEntry
+	for result.Next() {
+		var e StorageEntry
+		if err := result.Scan(&e.Namespace, &e.Player, &e.Key, &e.Value); err != nil {
+			return nil, err
+		}
+
+		out = append(out, e)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 func (a *AuthMTPostgreSQL) setTimestamp(name string, t time.Time) {
 	timestamp := t.Unix()
 	a.db.Exec("UPDATE auth SET last_login = $1 WHERE name = $2;", timestamp, name)
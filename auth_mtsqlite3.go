@@ -39,6 +39,31 @@ func NewAuthMTSQLite3() (*AuthMTSQLite3, error) {
 		return nil, err
 	}
 
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS whitelist (name VARCHAR(32) PRIMARY KEY);"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS last_server (name VARCHAR(32) NOT NULL, grp TEXT NOT NULL, server TEXT NOT NULL, PRIMARY KEY (name, grp));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS user_groups (name VARCHAR(32) NOT NULL, grp TEXT NOT NULL, expiry INTEGER NOT NULL, PRIMARY KEY (name, grp));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS user_perms (name VARCHAR(32) NOT NULL, perm TEXT NOT NULL, expiry INTEGER NOT NULL, PRIMARY KEY (name, perm));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS storage (namespace TEXT NOT NULL, player TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL, PRIMARY KEY (namespace, player, key));"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &AuthMTSQLite3{db}, nil
 }
 
@@ -84,18 +109,72 @@ func (a *AuthMTSQLite3) SetPasswd(name string, salt, verifier []byte) error {
 	return err
 }
 
-// LastSrv always returns an error
-// since the Minetest database schema cannot store this information.
-func (a *AuthMTSQLite3) LastSrv(_ string) (string, error) {
-	return "", ErrLastSrvNotSupported
+// LastSrv returns the last server a user was on.
+// It is stored in a separate table that is not part
+// of the Minetest database schema.
+func (a *AuthMTSQLite3) LastSrv(name string) (string, error) {
+	return a.LastGroupSrv(name, "")
+}
+
+// SetLastSrv sets the last server a user was on.
+func (a *AuthMTSQLite3) SetLastSrv(name, srv string) error {
+	return a.SetLastGroupSrv(name, "", srv)
+}
+
+// LastGroupSrv returns the last server a user was on
+// within a server group.
+func (a *AuthMTSQLite3) LastGroupSrv(name, group string) (string, error) {
+	result := a.db.QueryRow("SELECT server FROM last_server WHERE name = ? AND grp = ?;", name, group)
+
+	var srv string
+	err := result.Scan(&srv)
+	return srv, err
+}
+
+// SetLastGroupSrv sets the last server a user was on
+// within a server group.
+func (a *AuthMTSQLite3) SetLastGroupSrv(name, group, srv string) error {
+	_, err := a.db.Exec("REPLACE INTO last_server (name, grp, server) VALUES (?, ?, ?);", name, group, srv)
+	return err
 }
 
-// SetLastSrv is a no-op
-// since the Minetest database schema cannot store this information.
-func (a *AuthMTSQLite3) SetLastSrv(_, _ string) error {
+// ImportLastSrvs sets the passed last servers.
+func (a *AuthMTSQLite3) ImportLastSrvs(in []LastSrvEntry) error {
+	for _, e := range in {
+		if err := a.SetLastGroupSrv(e.Name, e.Group, e.Srv); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ExportLastSrvs returns data that can be processed by ImportLastSrvs
+// or an error.
+func (a *AuthMTSQLite3) ExportLastSrvs() ([]LastSrvEntry, error) {
+	result, err := a.db.Query("SELECT name, grp, server FROM last_server;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []LastSrvEntry
+	for result.Next() {
+		var e LastSrvEntry
+		if err := result.Scan(&e.Name, &e.Group, &e.Srv); err != nil {
+			return nil, err
+		}
+
+		out = append(out, e)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // Timestamp returns the last time an authentication entry was accessed
 // or an error.
 func (a *AuthMTSQLite3) Timestamp(name string) (time.Time, error) {
@@ -247,6 +326,301 @@ func (a *AuthMTSQLite3) ExportBans() ([]Ban, error) {
 	return unmapped, nil
 }
 
+// AddWhitelist adds a player to the whitelist.
+func (a *AuthMTSQLite3) AddWhitelist(name string) error {
+	_, err := a.db.Exec("INSERT OR IGNORE INTO whitelist (name) VALUES (?);", name)
+	return err
+}
+
+// RmWhitelist removes a player from the whitelist.
+// It is not an error if the player isn't whitelisted.
+func (a *AuthMTSQLite3) RmWhitelist(name string) error {
+	_, err := a.db.Exec("DELETE FROM whitelist WHERE name = ?;", name)
+	return err
+}
+
+// Whitelisted reports whether a player is whitelisted.
+// Error cases count as not whitelisted.
+func (a *AuthMTSQLite3) Whitelisted(name string) bool {
+	result := a.db.QueryRow("SELECT COUNT(1) FROM whitelist WHERE name = ?;", name)
+
+	var count int
+	if err := result.Scan(&count); err != nil {
+		return false
+	}
+
+	return count == 1
+}
+
+// ImportWhitelist adds the passed players to the whitelist.
+func (a *AuthMTSQLite3) ImportWhitelist(in []string) error {
+	for _, name := range in {
+		if err := a.AddWhitelist(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportWhitelist returns data that can be processed by ImportWhitelist
+// or an error.
+func (a *AuthMTSQLite3) ExportWhitelist() ([]string, error) {
+	result, err := a.db.Query("SELECT name FROM whitelist;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []string
+	for result.Next() {
+		var name string
+		if err := result.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		out = append(out, name)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// AddUserGroup adds a player to a permission group.
+// An existing assignment is replaced.
+// A zero expiry means that the assignment never expires.
+func (a *AuthMTSQLite3) AddUserGroup(name, group string, expiry time.Time) error {
+	_, err := a.db.Exec("REPLACE INTO user_groups (name, grp, expiry) VALUES (?, ?, ?);", name, group, unixExpiry(expiry))
+	return err
+}
+
+// RmUserGroup removes a player from a permission group.
+// It is not an error if the player isn't a member of the group.
+func (a *AuthMTSQLite3) RmUserGroup(name, group string) error {
+	_, err := a.db.Exec("DELETE FROM user_groups WHERE name = ? AND grp = ?;", name, group)
+	return err
+}
+
+// UserGroups returns the permission groups of a player
+// including expired ones.
+func (a *AuthMTSQLite3) UserGroups(name string) ([]UserGroup, error) {
+	return a.queryUserGroups("SELECT name, grp, expiry FROM user_groups WHERE name = ?;", name)
+}
+
+// ImportUserGroups adds the passed group assignments.
+func (a *AuthMTSQLite3) ImportUserGroups(in []UserGroup) error {
+	for _, x := range in {
+		if err := a.AddUserGroup(x.Name, x.Group, x.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserGroups returns data that can be processed by ImportUserGroups
+// or an error.
+func (a *AuthMTSQLite3) ExportUserGroups() ([]UserGroup, error) {
+	return a.queryUserGroups("SELECT name, grp, expiry FROM user_groups;")
+}
+
+func (a *AuthMTSQLite3) queryUserGroups(query string, args ...interface{}) ([]UserGroup, error) {
+	result, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []UserGroup
+	for result.Next() {
+		var x UserGroup
+		var expiry int64
+		if err := result.Scan(&x.Name, &x.Group, &expiry); err != nil {
+			return nil, err
+		}
+
+		if expiry != 0 {
+			x.Expiry = time.Unix(expiry, 0)
+		}
+
+		out = append(out, x)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// AddUserPerm grants a permission to a player.
+// An existing grant is replaced.
+// A zero expiry means that the grant never expires.
+func (a *AuthMTSQLite3) AddUserPerm(name, perm string, expiry time.Time) error {
+	_, err := a.db.Exec("REPLACE INTO user_perms (name, perm, expiry) VALUES (?, ?, ?);", name, perm, unixExpiry(expiry))
+	return err
+}
+
+// RmUserPerm revokes a permission granted by AddUserPerm.
+// It is not an error if the permission hasn't been granted.
+func (a *AuthMTSQLite3) RmUserPerm(name, perm string) error {
+	_, err := a.db.Exec("DELETE FROM user_perms WHERE name = ? AND perm = ?;", name, perm)
+	return err
+}
+
+// UserPerms returns the permissions granted to a player directly
+// including expired ones.
+func (a *AuthMTSQLite3) UserPerms(name string) ([]UserPerm, error) {
+	return a.queryUserPerms("SELECT name, perm, expiry FROM user_perms WHERE name = ?;", name)
+}
+
+// ImportUserPerms adds the passed permission grants.
+func (a *AuthMTSQLite3) ImportUserPerms(in []UserPerm) error {
+	for _, x := range in {
+		if err := a.AddUserPerm(x.Name, x.Perm, x.Expiry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportUserPerms returns data that can be processed by ImportUserPerms
+// or an error.
+func (a *AuthMTSQLite3) ExportUserPerms() ([]UserPerm, error) {
+	return a.queryUserPerms("SELECT name, perm, expiry FROM user_perms;")
+}
+
+func (a *AuthMTSQLite3) queryUserPerms(query string, args ...interface{}) ([]UserPerm, error) {
+	result, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []UserPerm
+	for result.Next() {
+		var x UserPerm
+		var expiry int64
+		if err := result.Scan(&x.Name, &x.Perm, &expiry); err != nil {
+			return nil, err
+		}
+
+		if expiry != 0 {
+			x.Expiry = time.Unix(expiry, 0)
+		}
+
+		out = append(out, x)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// StorageGet returns the value of a plugin storage key.
+// The player is empty for global keys.
+func (a *AuthMTSQLite3) StorageGet(namespace, player, key string) (string, error) {
+	result := a.db.QueryRow("SELECT value FROM storage WHERE namespace = ? AND player = ? AND key = ?;", namespace, player, key)
+
+	var value string
+	if err := result.Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoStorageKey
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
+
+// StorageSet sets the value of a plugin storage key,
+// creating it if necessary.
+func (a *AuthMTSQLite3) StorageSet(namespace, player, key, value string) error {
+	if !validStorageName(namespace) || !validStorageName(key) {
+		return ErrInvalidStorageKey
+	}
+
+	_, err := a.db.Exec("REPLACE INTO storage (namespace, player, key, value) VALUES (?, ?, ?, ?);", namespace, player, key, value)
+	return err
+}
+
+// StorageRm deletes a plugin storage key.
+// It is not an error if the key doesn't exist.
+func (a *AuthMTSQLite3) StorageRm(namespace, player, key string) error {
+	_, err := a.db.Exec("DELETE FROM storage WHERE namespace = ? AND player = ? AND key = ?;", namespace, player, key)
+	return err
+}
+
+// StorageKeys returns all keys of a plugin storage namespace
+// for the player or the global keys if the player is empty.
+func (a *AuthMTSQLite3) StorageKeys(namespace, player string) ([]string, error) {
+	result, err := a.db.Query("SELECT key FROM storage WHERE namespace = ? AND player = ?;", namespace, player)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var keys []string
+	for result.Next() {
+		var key string
+		if err := result.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ImportStorage adds the passed plugin storage entries.
+func (a *AuthMTSQLite3) ImportStorage(in []StorageEntry) error {
+	for _, e := range in {
+		if err := a.StorageSet(e.Namespace, e.Player, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportStorage returns data that can be processed by ImportStorage
+// or an error.
+func (a *AuthMTSQLite3) ExportStorage() ([]StorageEntry, error) {
+	result, err := a.db.Query("SELECT namespace, player, key, value FROM storage;")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var out []StorageEntry
+	for result.Next() {
+		var e StorageEntry
+		if err := result.Scan(&e.Namespace, &e.Player, &e.Key, &e.Value); err != nil {
+			return nil, err
+		}
+
+		out = append(out, e)
+	}
+
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 func (a *AuthMTSQLite3) setTimestamp(name string, t time.Time) {
 	timestamp := t.Unix()
 	a.db.Exec("UPDATE auth SET last_login = ? WHERE name = ?;", timestamp, name)
@@ -1,9 +1,15 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/HimbeerserverDE/mt"
 )
@@ -12,6 +18,17 @@ import (
 // about a chat command that's taking long to execute.
 var ChatCmdTimeout = 10 * time.Second
 
+var (
+	ErrUnterminatedQuote  = errors.New("unterminated quote")
+	ErrUnterminatedEscape = errors.New("unterminated escape sequence")
+)
+
+// chatCmdCooldowns holds the last time a player used a command.
+// It is indexed by the command path, e.g. "whitelist add",
+// and the name of the player.
+var chatCmdCooldowns = make(map[string]map[string]time.Time)
+var chatCmdCooldownsMu sync.Mutex
+
 // DoChatMsg handles a chat message string
 // as if it was sent by the ClientConn.
 func (cc *ClientConn) DoChatMsg(msg string) {
@@ -41,15 +58,79 @@ func Colorize(text, color string) string {
 	return string([]rune{0x1b}) + "(c@" + color + ")" + text + string([]rune{0x1b}) + "(c@#FFF)"
 }
 
+// SplitChatCmdArgs splits a command line into its arguments.
+// Arguments are separated by whitespace. A double quote at the start
+// of an argument groups multiple words into a single argument
+// up to the next double quote. Quotes inside of words,
+// e.g. apostrophes, are kept. A backslash escapes the next character.
+func SplitChatCmdArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+
+	inArg := false
+	quoted := false
+	escape := false
+
+	for _, r := range line {
+		switch {
+		case escape:
+			arg.WriteRune(r)
+			escape = false
+		case r == '\\':
+			inArg = true
+			escape = true
+		case quoted:
+			if r == '"' {
+				quoted = false
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' && !inArg:
+			inArg = true
+			quoted = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			arg.WriteRune(r)
+		}
+	}
+
+	if escape {
+		return nil, ErrUnterminatedEscape
+	}
+
+	if quoted {
+		return nil, ErrUnterminatedQuote
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
 func onChatMsg(cc *ClientConn, cmd *mt.ToSrvChatMsg) (string, bool) {
 	initChatCmds()
 
-	if strings.HasPrefix(cmd.Msg, Conf().CmdPrefix) {
-		substrs := strings.Split(cmd.Msg, " ")
-		cmdName := strings.Replace(substrs[0], Conf().CmdPrefix, "", 1)
+	prefix := Conf().CmdPrefix
+	if strings.HasPrefix(cmd.Msg, prefix) {
+		substrs, err := SplitChatCmdArgs(strings.TrimPrefix(cmd.Msg, prefix))
+		if err != nil {
+			cc.Log("->", "command", cmd.Msg)
+			cc.Log("<-", "invalid command", err)
+			return "Invalid command: " + err.Error() + ".", true
+		}
 
+		var cmdName string
 		var args []string
-		if len(substrs) > 1 {
+		if len(substrs) > 0 {
+			cmdName = substrs[0]
 			args = substrs[1:]
 		}
 
@@ -63,23 +144,229 @@ func onChatMsg(cc *ClientConn, cmd *mt.ToSrvChatMsg) (string, bool) {
 
 		cc.Log("->", v...)
 
-		if !ChatCmdExists(cmdName) {
+		cmd, ok := lookupChatCmd(cmdName)
+		if !ok {
 			cc.Log("<-", "unknown command", cmdName)
 			return "Command not found.", true
 		}
 
-		chatCmdsMu.RLock()
-		defer chatCmdsMu.RUnlock()
+		return runChatCmd(cc, cmd, cmd.Name, args), true
+	}
+
+	return "", false
+}
+
+// runChatCmd executes a ChatCmd or one of its subcommands.
+// The path is the name of the command and all of its parents.
+func runChatCmd(cc *ClientConn, cmd ChatCmd, path string, args []string) string {
+	if !cc.HasPerms(cmd.Perm) {
+		cc.Log("<-", "deny command", path)
+		return fmt.Sprintf("Missing permission %s.", cmd.Perm)
+	}
+
+	if len(args) > 0 {
+		if sub, ok := cmd.subCmd(args[0]); ok {
+			sub.Name = cmd.Name + " " + sub.Name
+			return runChatCmd(cc, sub, path+" "+args[0], args[1:])
+		}
+	}
+
+	usage := "Usage: " + Conf().CmdPrefix + cmd.FullUsage()
+	if cmd.Handler == nil {
+		return usage
+	}
 
-		cmd := chatCmds[cmdName]
+	if err := checkChatCmdArgs(cmd.Args, args); err != nil {
+		return err.Error() + " " + usage
+	}
 
-		if !cc.HasPerms(cmd.Perm) {
-			cc.Log("<-", "deny command", cmdName)
-			return fmt.Sprintf("Missing permission %s.", cmd.Perm), true
+	if wait := chatCmdCooldown(cc, cmd.Name, cmd.Cooldown); wait > 0 {
+		cc.Log("<-", "cooldown command", path)
+		return fmt.Sprintf("Please wait %d seconds before using this command again.", int(math.Ceil(wait.Seconds())))
+	}
+
+	return cmd.Handler(cc, args...)
+}
+
+// checkChatCmdArgs reports whether the arguments
+// match the declarations. It always succeeds if decl is nil.
+func checkChatCmdArgs(decl []ChatCmdArg, args []string) error {
+	if decl == nil {
+		return nil
+	}
+
+	for i, d := range decl {
+		if i >= len(args) {
+			if !d.Optional {
+				return fmt.Errorf("Missing argument %s.", d)
+			}
+
+			return nil
+		}
+
+		values := args[i : i+1]
+		if d.Variadic {
+			values = args[i:]
 		}
 
-		return cmd.Handler(cc, args...), true
+		for _, value := range values {
+			if err := checkChatCmdArg(d, value); err != nil {
+				return err
+			}
+		}
 	}
 
-	return "", false
+	if len(decl) == 0 || !decl[len(decl)-1].Variadic {
+		if len(args) > len(decl) {
+			return errors.New("Too many arguments.")
+		}
+	}
+
+	return nil
+}
+
+func checkChatCmdArg(d ChatCmdArg, value string) error {
+	var err error
+	switch d.Type {
+	case IntArg:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case FloatArg:
+		_, err = strconv.ParseFloat(value, 64)
+	case BoolArg:
+		_, err = strconv.ParseBool(value)
+	case PlayerArg:
+		if Find(value) == nil {
+			return fmt.Errorf("Player %s is not connected.", value)
+		}
+	case ServerArg:
+		if _, ok := Conf().Servers[value]; !ok {
+			return fmt.Errorf("Server %s does not exist.", value)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("Invalid %s %s for argument %s.", d.Type, strconv.Quote(value), d)
+	}
+
+	return nil
+}
+
+// chatCmdCooldown returns the remaining cooldown of a command
+// for the ClientConn. If it is zero the cooldown is restarted.
+func chatCmdCooldown(cc *ClientConn, path string, cooldown time.Duration) time.Duration {
+	if cooldown <= 0 {
+		return 0
+	}
+
+	chatCmdCooldownsMu.Lock()
+	defer chatCmdCooldownsMu.Unlock()
+
+	last, ok := chatCmdCooldowns[path]
+	if !ok {
+		last = make(map[string]time.Time)
+		chatCmdCooldowns[path] = last
+	}
+
+	now := time.Now()
+	for name, t := range last {
+		if now.Sub(t) >= cooldown {
+			delete(last, name)
+		}
+	}
+
+	if t, ok := last[cc.Name()]; ok {
+		return cooldown - now.Sub(t)
+	}
+
+	last[cc.Name()] = now
+	return 0
+}
+
+// rmChatCmdCooldowns removes the cooldowns of a command
+// and all of its subcommands.
+func rmChatCmdCooldowns(name string) {
+	chatCmdCooldownsMu.Lock()
+	defer chatCmdCooldownsMu.Unlock()
+
+	for path := range chatCmdCooldowns {
+		if path == name || strings.HasPrefix(path, name+" ") {
+			delete(chatCmdCooldowns, path)
+		}
+	}
+}
+
+func init() {
+	RegisterChatCmd(ChatCmd{
+		Name: "help",
+		Help: "Show the available commands or information on a command.",
+		Args: []ChatCmdArg{
+			{Name: "command", Optional: true, Variadic: true},
+		},
+		Handler: func(cc *ClientConn, args ...string) string {
+			prefix := Conf().CmdPrefix
+
+			if len(args) == 0 {
+				var names []string
+				for name, cmd := range ChatCmds() {
+					if cc.HasPerms(cmd.Perm) {
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+
+				var b strings.Builder
+				b.WriteString("Available commands:")
+				for _, name := range names {
+					b.WriteString("\n" + prefix + name)
+					if help := ChatCmds()[name].Help; help != "" {
+						b.WriteString(": " + help)
+					}
+				}
+
+				return b.String()
+			}
+
+			cmd, ok := lookupChatCmd(args[0])
+			if !ok || !cc.HasPerms(cmd.Perm) {
+				return "Command not found."
+			}
+
+			for _, arg := range args[1:] {
+				sub, ok := cmd.subCmd(arg)
+				if !ok || !cc.HasPerms(sub.Perm) {
+					return "Command not found."
+				}
+
+				sub.Name = cmd.Name + " " + sub.Name
+				cmd = sub
+			}
+
+			var b strings.Builder
+			b.WriteString("Usage: " + prefix + cmd.FullUsage())
+			if cmd.Help != "" {
+				b.WriteString("\n" + cmd.Help)
+			}
+
+			if len(cmd.Aliases) > 0 {
+				b.WriteString("\nAliases: " + strings.Join(cmd.Aliases, ", "))
+			}
+
+			var subs []string
+			for _, sub := range cmd.SubCmds {
+				if cc.HasPerms(sub.Perm) {
+					subs = append(subs, sub.Name)
+				}
+			}
+
+			if len(subs) > 0 {
+				b.WriteString("\nSubcommands: " + strings.Join(subs, ", "))
+			}
+
+			if cmd.Cooldown > 0 {
+				b.WriteString("\nCooldown: " + cmd.Cooldown.String())
+			}
+
+			return b.String()
+		},
+	})
 }
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitChatCmdArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+		err  error
+	}{
+		{"", nil, nil},
+		{"   ", nil, nil},
+		{"kick bob", []string{"kick", "bob"}, nil},
+		{"  kick \t bob  ", []string{"kick", "bob"}, nil},
+		{"alert Server's restarting", []string{"alert", "Server's", "restarting"}, nil},
+		{"kick bob don't spam", []string{"kick", "bob", "don't", "spam"}, nil},
+		{"say 5\" tall", []string{"say", "5\"", "tall"}, nil},
+		{"'single quotes' stay", []string{"'single", "quotes'", "stay"}, nil},
+		{`alert "Server restart soon"`, []string{"alert", "Server restart soon"}, nil},
+		{`alert "it's fine"`, []string{"alert", "it's fine"}, nil},
+		{`a "" b`, []string{"a", "", "b"}, nil},
+		{`a ""`, []string{"a", ""}, nil},
+		{`"a b"c d`, []string{"a bc", "d"}, nil},
+		{`a\ b c`, []string{"a b", "c"}, nil},
+		{`a \"b c`, []string{"a", `"b`, "c"}, nil},
+		{`"a \" b"`, []string{`a " b`}, nil},
+		{`a \\`, []string{"a", `\`}, nil},
+		{`alert "unterminated`, nil, ErrUnterminatedQuote},
+		{`"`, nil, ErrUnterminatedQuote},
+		{`a\`, nil, ErrUnterminatedEscape},
+	}
+
+	for _, tt := range tests {
+		args, err := SplitChatCmdArgs(tt.line)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("SplitChatCmdArgs(%q): got error %v, want %v", tt.line, err, tt.err)
+			continue
+		}
+
+		if !slices.Equal(args, tt.args) {
+			t.Errorf("SplitChatCmdArgs(%q) = %q, want %q", tt.line, args, tt.args)
+		}
+	}
+}
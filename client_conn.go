@@ -54,6 +54,12 @@ type ClientConn struct {
 	p0Map     param0Map
 	p0SrvMap  param0SrvMap
 	media     []mediaFile
+	names     *contentNames
+
+	dynMedia       map[string]*dynMediaFile
+	dynMediaTokens map[uint32]dynMediaToken
+	dynMediaToken  uint32
+	dynMediaMu     sync.Mutex
 
 	playerCAO, currentCAO mt.AOID
 
@@ -63,6 +69,13 @@ type ClientConn struct {
 	modChsMu sync.RWMutex
 
 	cltInfo *mt.ToSrvCltInfo
+
+	grants   *playerGrants
+	grantsMu sync.Mutex
+
+	handoff     *Handoff
+	handoffMeta map[string]string
+	handoffMu   sync.RWMutex
 }
 
 // Name returns the player name of the ClientConn.
@@ -117,8 +130,10 @@ func handleClt(cc *ClientConn) {
 		pkt, err := cc.Recv()
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) {
+				lt := Exit
 				if errors.Is(cc.WhyClosed(), rudp.ErrTimedOut) {
 					cc.Log("<->", "timeout")
+					lt = Timeout
 				} else {
 					cc.Log("<->", "disconnect")
 				}
@@ -141,6 +156,10 @@ func handleClt(cc *ClientConn) {
 					cc.mu.Unlock()
 				}
 
+				if cc.state() >= csActive {
+					handleLeave(cc, lt)
+				}
+
 				break
 			}
 
@@ -81,5 +81,50 @@ func convert(dst, src proxy.AuthBackend) error {
 		return err
 	}
 
+	whitelist, err := src.ExportWhitelist()
+	if err != nil {
+		return err
+	}
+
+	if err := dst.ImportWhitelist(whitelist); err != nil {
+		return err
+	}
+
+	lastSrvs, err := src.ExportLastSrvs()
+	if err != nil {
+		return err
+	}
+
+	if err := dst.ImportLastSrvs(lastSrvs); err != nil {
+		return err
+	}
+
+	groups, err := src.ExportUserGroups()
+	if err != nil {
+		return err
+	}
+
+	if err := dst.ImportUserGroups(groups); err != nil {
+		return err
+	}
+
+	perms, err := src.ExportUserPerms()
+	if err != nil {
+		return err
+	}
+
+	if err := dst.ImportUserPerms(perms); err != nil {
+		return err
+	}
+
+	storage, err := src.ExportStorage()
+	if err != nil {
+		return err
+	}
+
+	if err := dst.ImportStorage(storage); err != nil {
+		return err
+	}
+
 	return nil
 }
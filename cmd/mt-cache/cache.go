@@ -0,0 +1,185 @@
+/*
+mt-cache inspects and maintains the media cache of the proxy.
+
+Usage:
+
+	mt-cache stats
+	mt-cache list
+	mt-cache verify [-fix]
+	mt-cache gc
+	mt-cache prune [size]
+
+stats prints the number of cached files and their total size per media pool.
+list prints the hash, size, last use and media pools of every cached file.
+verify re-hashes all cached files and reports the corrupt ones.
+If -fix is specified they are removed.
+gc removes the files that aren't used by any configured media pool
+except for dynamic media within its retention period.
+prune removes the least recently used files until the cache
+is no larger than size, which defaults to the MediaCache.MaxSize
+config option. The size may have a K, M or G suffix.
+
+The proxy should be stopped while the cache is modified.
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	proxy "github.com/HimbeerserverDE/mt-multiserver-proxy"
+)
+
+const usage = "usage: mt-cache stats | list | verify [-fix] | gc | prune [size]"
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch os.Args[1] {
+	case "stats":
+		stats()
+	case "list":
+		list()
+	case "verify":
+		fix := len(os.Args) > 2 && os.Args[2] == "-fix"
+
+		corrupt, err := proxy.VerifyCache(fix)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, hash := range corrupt {
+			fmt.Println(hash)
+		}
+
+		if fix {
+			log.Printf("removed %d corrupt files", len(corrupt))
+		} else {
+			log.Printf("found %d corrupt files", len(corrupt))
+		}
+	case "gc":
+		n, freed, err := proxy.GCCache()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("removed %d unused files (%s)", n, formatSize(freed))
+	case "prune":
+		maxSize := proxy.Conf().MediaCache.MaxSize
+		if len(os.Args) > 2 {
+			var err error
+			maxSize, err = parseSize(os.Args[2])
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if maxSize <= 0 {
+			log.Fatal("no size limit specified or configured")
+		}
+
+		n, freed, err := proxy.PruneCache(maxSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("removed %d files (%s)", n, formatSize(freed))
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func stats() {
+	entries, err := proxy.CacheEntries()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var total int64
+	counts := make(map[string]int)
+	sizes := make(map[string]int64)
+
+	for _, e := range entries {
+		total += e.Size
+
+		pools := e.Pools
+		if len(pools) == 0 {
+			pools = []string{"(unused)"}
+		}
+
+		for _, pool := range pools {
+			counts[pool]++
+			sizes[pool] += e.Size
+		}
+	}
+
+	var pools []string
+	for pool := range counts {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	fmt.Printf("%d files, %s\n", len(entries), formatSize(total))
+	for _, pool := range pools {
+		fmt.Printf("%s: %d files, %s\n", pool, counts[pool], formatSize(sizes[pool]))
+	}
+}
+
+func list() {
+	entries, err := proxy.CacheEntries()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, e := range entries {
+		var dynamic string
+		if e.Dynamic {
+			dynamic = " dynamic"
+		}
+
+		fmt.Printf("%s %d %s %s%s\n", e.Hash, e.Size, e.LastUsed.Format(time.RFC3339), strings.Join(e.Pools, ","), dynamic)
+	}
+}
+
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * mult, nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
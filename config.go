@@ -18,6 +18,9 @@ const (
 	defaultTelnetAddr   = "[::1]:40010"
 	defaultBindAddr     = ":40000"
 	defaultListInterval = 300
+	defaultMediaSrvAddr = ":40001"
+	defaultDynRetention = 7
+	defaultWhitelistMsg = "You are not whitelisted on this server."
 )
 
 var config Config
@@ -30,16 +33,30 @@ type Server struct {
 	MediaPool string
 	Groups    []string
 	Fallbacks []string
+	Trusted   bool
 
 	dynamic   bool
 	poolAdded time.Time
 }
 
+// A MediaPool contains settings that apply to all servers
+// of a media pool.
+type MediaPool struct {
+	SharedMods []string
+	Prefix     string
+	NoPrefix   bool
+	Exempt     []string
+}
+
 // A Config contains information from the configuration file
 // that affects the way the proxy works.
 type Config struct {
 	NoPlugins        bool
 	NoAutoPlugins    bool
+	NoRPCPlugins     bool
+	NoScripts        bool
+	NoAdminCmds      bool
+	DisableAdminCmds []string
 	CmdPrefix        string
 	RequirePasswd    bool
 	SendInterval     float32
@@ -51,9 +68,11 @@ type Config struct {
 	BindAddr         string
 	DefaultSrv       string
 	Servers          map[string]Server
+	MediaPools       map[string]MediaPool
 	ForceDefaultSrv  bool
 	KickOnNewPool    bool
 	FallbackServers  []string
+	Handoffs         []HandoffRule
 	CSMRF            struct {
 		NoCSMs          bool
 		ChatMsgs        bool
@@ -62,11 +81,19 @@ type Config struct {
 		NoLimitMapRange bool
 		PlayerList      bool
 	}
-	MapRange   uint32
-	DropCSMRF  bool
-	Groups     map[string][]string
-	UserGroups map[string]string
-	List       struct {
+	MapRange     uint32
+	DropCSMRF    bool
+	Groups       map[string][]string
+	GroupInherit map[string][]string
+	GroupPrivs   map[string][]string
+	UserGroups   map[string]string
+	Plugins      map[string]json.RawMessage
+	Whitelist    struct {
+		Enable bool
+		Groups []string
+		Msg    string
+	}
+	List struct {
 		Enable   bool
 		Addr     string
 		Interval int
@@ -81,6 +108,16 @@ type Config struct {
 		FarNames bool
 		Mods     []string
 	}
+	MediaCache struct {
+		MaxSize          int64
+		GC               bool
+		DynamicRetention int
+	}
+	MediaServer struct {
+		Enable bool
+		Addr   string
+		URL    string
+	}
 }
 
 // Conf returns a copy of the Config used by the proxy.
@@ -130,6 +167,7 @@ func AddServer(name string, s Server) bool {
 	}
 
 	config.Servers[name] = s
+	FlushContentCache()
 	return true
 }
 
@@ -168,8 +206,31 @@ func (cnf Config) clone() Config {
 	newConfig.FallbackServers = make([]string, len(cnf.FallbackServers))
 	copy(newConfig.FallbackServers, cnf.FallbackServers)
 
+	newConfig.Handoffs = make([]HandoffRule, len(cnf.Handoffs))
+	for i, rule := range cnf.Handoffs {
+		newConfig.Handoffs[i] = rule
+		newConfig.Handoffs[i].State = make([]string, len(rule.State))
+		copy(newConfig.Handoffs[i].State, rule.State)
+	}
+
+	newConfig.MediaPools = make(map[string]MediaPool)
+	for name, pool := range cnf.MediaPools {
+		pool.SharedMods = append([]string{}, pool.SharedMods...)
+		pool.Exempt = append([]string{}, pool.Exempt...)
+		newConfig.MediaPools[name] = pool
+	}
+
+	newConfig.DisableAdminCmds = make([]string, len(cnf.DisableAdminCmds))
+	copy(newConfig.DisableAdminCmds, cnf.DisableAdminCmds)
+
 	newConfig.Groups = copyMapSlice(cnf.Groups)
+	newConfig.GroupInherit = copyMapSlice(cnf.GroupInherit)
+	newConfig.GroupPrivs = copyMapSlice(cnf.GroupPrivs)
 	newConfig.UserGroups = copyMap(cnf.UserGroups)
+	newConfig.Plugins = copyMap(cnf.Plugins)
+
+	newConfig.Whitelist.Groups = make([]string, len(cnf.Whitelist.Groups))
+	copy(newConfig.Whitelist.Groups, cnf.Whitelist.Groups)
 
 	newConfig.List.Mods = make([]string, len(cnf.List.Mods))
 	copy(newConfig.List.Mods, cnf.List.Mods)
@@ -318,6 +379,7 @@ func LoadConfig() error {
 
 	oldConf := config.clone()
 
+	config.DisableAdminCmds = make([]string, 0)
 	config.CmdPrefix = defaultCmdPrefix
 	config.SendInterval = defaultSendInterval
 	config.UserLimit = defaultUserLimit
@@ -325,11 +387,20 @@ func LoadConfig() error {
 	config.TelnetAddr = defaultTelnetAddr
 	config.BindAddr = defaultBindAddr
 	config.Servers = make(map[string]Server)
+	config.MediaPools = make(map[string]MediaPool)
 	config.FallbackServers = make([]string, 0)
+	config.Handoffs = make([]HandoffRule, 0)
 	config.Groups = make(map[string][]string)
+	config.GroupInherit = make(map[string][]string)
+	config.GroupPrivs = make(map[string][]string)
 	config.UserGroups = make(map[string]string)
+	config.Plugins = make(map[string]json.RawMessage)
+	config.Whitelist.Groups = make([]string, 0)
+	config.Whitelist.Msg = defaultWhitelistMsg
 	config.List.Interval = defaultListInterval
 	config.List.Mods = make([]string, 0)
+	config.MediaServer.Addr = defaultMediaSrvAddr
+	config.MediaCache.DynamicRetention = defaultDynRetention
 
 	f, err := os.OpenFile(Path("config.json"), os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
@@ -379,6 +450,11 @@ func LoadConfig() error {
 		}
 	}
 
+	if err := checkPoolNamings(config); err != nil {
+		config = oldConf.clone()
+		return err
+	}
+
 	poolKickOnce := sync.OnceFunc(func() {
 		for cc := range Clts() {
 			cc.Kick("A server with new media has been added to the network. Please reconnect to access it.")
@@ -404,6 +480,8 @@ func LoadConfig() error {
 		}
 	}
 
+	FlushContentCache()
+
 	log.Print("load config")
 	return nil
 }
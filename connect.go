@@ -37,6 +37,8 @@ func connect(conn net.Conn, name string, cc *ClientConn) *ServerConn {
 		sounds:           make(map[mt.SoundID]struct{}),
 		huds:             make(map[mt.HUDID]mt.HUDType),
 		playerList:       make(map[string]struct{}),
+		contentHash:      newContentHash(),
+		dynMediaReqs:     make(map[string]dynMediaReq),
 	}
 	sc.Log("->", "connect")
 
@@ -57,6 +59,8 @@ func connectContent(conn net.Conn, name, userName, mediaPool string) (*contentCo
 		name:      name,
 		userName:  userName,
 		mediaPool: mediaPool,
+
+		contentHash: newContentHash(),
 	}
 
 	go handleContent(cc)
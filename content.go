@@ -5,9 +5,10 @@ import (
 	"embed"
 	"encoding/base64"
 	"errors"
+	"hash"
 	"log"
 	"net"
-	"regexp"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -17,8 +18,6 @@ import (
 	"github.com/HimbeerserverDE/srp"
 )
 
-var disallowedChars = regexp.MustCompile("[^a-zA-Z0-9-_.:]")
-
 var b64 = base64.StdEncoding
 
 //go:embed textures/*
@@ -55,6 +54,8 @@ type contentConn struct {
 
 	media   []mediaFile
 	remotes []string
+
+	contentHash hash.Hash
 }
 
 func (cc *contentConn) state() clientState {
@@ -92,6 +93,11 @@ DirLoop:
 			return err
 		}
 
+		// Make the texture available to the remote media server.
+		if err := cacheMedia(cc.mediaPool, data, false); err != nil {
+			cc.log("->", "cache", err)
+		}
+
 		sum := sha1.Sum(data)
 		cc.media = append(cc.media, mediaFile{
 			name:       f.Name(),
@@ -234,15 +240,21 @@ func handleContent(cc *contentConn) {
 			cc.auth.method = 0
 			cc.SendCmd(&mt.ToSrvInit2{})
 		case *mt.ToCltItemDefs:
+			hashContent(cc.contentHash, cmd)
+
 			for _, def := range cmd.Defs {
 				cc.itemDefs = append(cc.itemDefs, def)
 			}
 			cc.aliases = cmd.Aliases
 		case *mt.ToCltNodeDefs:
+			hashContent(cc.contentHash, cmd)
+
 			for _, def := range cmd.Defs {
 				cc.nodeDefs = append(cc.nodeDefs, def)
 			}
 		case *mt.ToCltAnnounceMedia:
+			hashContent(cc.contentHash, cmd)
+
 			var filenames []string
 
 			for _, f := range cmd.Files {
@@ -304,36 +316,29 @@ func (cc *ClientConn) sendMedia(filenames []string) {
 
 	var bunchSize int
 	for _, filename := range filenames {
-		var known bool
-		for _, f := range cc.media {
-			if f.name == filename {
-				mfile := struct {
-					Name string
-					Data []byte
-				}{
-					Name: f.name,
-					Data: f.data,
-				}
-				bunches[len(bunches)-1] = append(bunches[len(bunches)-1], mfile)
-
-				bunchSize += len(f.data)
-				if bunchSize >= bytesPerMediaBunch {
-					bunches = append(bunches, []struct {
-						Name string
-						Data []byte
-					}{})
-					bunchSize = 0
-				}
-
-				known = true
-				break
-			}
-		}
-
-		if !known {
+		data, ok := cc.mediaData(filename)
+		if !ok {
 			cc.Log("->", "request unknown media file")
 			continue
 		}
+
+		mfile := struct {
+			Name string
+			Data []byte
+		}{
+			Name: filename,
+			Data: data,
+		}
+		bunches[len(bunches)-1] = append(bunches[len(bunches)-1], mfile)
+
+		bunchSize += len(data)
+		if bunchSize >= bytesPerMediaBunch {
+			bunches = append(bunches, []struct {
+				Name string
+				Data []byte
+			}{})
+			bunchSize = 0
+		}
 	}
 
 	for i := uint16(0); i < uint16(len(bunches)); i++ {
@@ -345,6 +350,18 @@ func (cc *ClientConn) sendMedia(filenames []string) {
 	}
 }
 
+// mediaData returns the content of a media file
+// announced to the client or pushed to it.
+func (cc *ClientConn) mediaData(filename string) ([]byte, bool) {
+	for _, f := range cc.media {
+		if f.name == filename {
+			return f.data, true
+		}
+	}
+
+	return cc.dynMediaData(filename)
+}
+
 type param0Map map[string]map[mt.Content]mt.Content
 type param0SrvMap map[mt.Content]struct {
 	name   string
@@ -365,7 +382,7 @@ func muxErrors(conns []*contentConn) map[string]struct{} {
 	return denyPools
 }
 
-func muxItemDefs(conns []*contentConn) ([]mt.ItemDef, []struct{ Alias, Orig string }) {
+func muxItemDefs(conns []*contentConn, names *contentNames) ([]mt.ItemDef, []struct{ Alias, Orig string }) {
 	var itemDefs []mt.ItemDef
 	var aliases []struct{ Alias, Orig string }
 
@@ -380,28 +397,39 @@ func muxItemDefs(conns []*contentConn) ([]mt.ItemDef, []struct{ Alias, Orig stri
 		PointRange: 4,
 	})
 
+	sharedDone := make(map[string]struct{})
+
 	for _, cc := range conns {
 		<-cc.done()
+		p := names.prefixer(cc.mediaPool)
 		for _, def := range cc.itemDefs {
 			if def.Name == "" {
 				def.Name = "hand"
 			}
 
-			prepend(cc.mediaPool, &def.Name)
-			prependTexture(cc.mediaPool, &def.InvImg)
-			prependTexture(cc.mediaPool, &def.WieldImg)
-			prepend(cc.mediaPool, &def.PlacePredict)
-			prepend(cc.mediaPool, &def.PlaceSnd.Name)
-			prepend(cc.mediaPool, &def.PlaceFailSnd.Name)
-			prependTexture(cc.mediaPool, &def.Palette)
-			prependTexture(cc.mediaPool, &def.InvOverlay)
-			prependTexture(cc.mediaPool, &def.WieldOverlay)
+			if names.isShared(cc.mediaPool, def.Name) {
+				if _, ok := sharedDone[def.Name]; ok {
+					continue
+				}
+
+				sharedDone[def.Name] = struct{}{}
+			}
+
+			prepend(p, &def.Name)
+			prependTexture(p, &def.InvImg)
+			prependTexture(p, &def.WieldImg)
+			prepend(p, &def.PlacePredict)
+			prepend(p, &def.PlaceSnd.Name)
+			prepend(p, &def.PlaceFailSnd.Name)
+			prependTexture(p, &def.Palette)
+			prependTexture(p, &def.InvOverlay)
+			prependTexture(p, &def.WieldOverlay)
 			itemDefs = append(itemDefs, def)
 		}
 
 		for _, alias := range cc.aliases {
-			prepend(cc.mediaPool, &alias.Alias)
-			prepend(cc.mediaPool, &alias.Orig)
+			prepend(p, &alias.Alias)
+			prepend(p, &alias.Orig)
 
 			aliases = append(aliases, struct{ Alias, Orig string }{
 				Alias: alias.Alias,
@@ -413,7 +441,7 @@ func muxItemDefs(conns []*contentConn) ([]mt.ItemDef, []struct{ Alias, Orig stri
 	return itemDefs, aliases
 }
 
-func muxNodeDefs(conns []*contentConn) (nodeDefs []mt.NodeDef, p0Map param0Map, p0SrvMap param0SrvMap) {
+func muxNodeDefs(conns []*contentConn, names *contentNames) (nodeDefs []mt.NodeDef, p0Map param0Map, p0SrvMap param0SrvMap) {
 	var param0 mt.Content
 
 	p0Map = make(param0Map)
@@ -438,8 +466,11 @@ func muxNodeDefs(conns []*contentConn) (nodeDefs []mt.NodeDef, p0Map param0Map,
 		},
 	}
 
+	sharedP0 := make(map[string]mt.Content)
+
 	for _, cc := range conns {
 		<-cc.done()
+		p := names.prefixer(cc.mediaPool)
 		for _, def := range cc.nodeDefs {
 			if p0Map[cc.name] == nil {
 				p0Map[cc.name] = map[mt.Content]mt.Content{
@@ -449,6 +480,16 @@ func muxNodeDefs(conns []*contentConn) (nodeDefs []mt.NodeDef, p0Map param0Map,
 				}
 			}
 
+			// Shared nodes only get a single content ID.
+			// The reverse mapping points to the first server.
+			shared := names.isShared(cc.mediaPool, def.Name)
+			if p0, ok := sharedP0[def.Name]; ok && shared {
+				p0Map[cc.name][def.Param0] = p0
+				continue
+			} else if shared {
+				sharedP0[def.Name] = param0
+			}
+
 			p0Map[cc.name][def.Param0] = param0
 			p0SrvMap[param0] = struct {
 				name   string
@@ -459,27 +500,27 @@ func muxNodeDefs(conns []*contentConn) (nodeDefs []mt.NodeDef, p0Map param0Map,
 			}
 
 			def.Param0 = param0
-			prepend(cc.mediaPool, &def.Name)
-			prepend(cc.mediaPool, &def.Mesh)
+			prepend(p, &def.Name)
+			prepend(p, &def.Mesh)
 			for i := range def.Tiles {
-				prependTexture(cc.mediaPool, &def.Tiles[i].Texture)
+				prependTexture(p, &def.Tiles[i].Texture)
 			}
 			for i := range def.OverlayTiles {
-				prependTexture(cc.mediaPool, &def.OverlayTiles[i].Texture)
+				prependTexture(p, &def.OverlayTiles[i].Texture)
 			}
 			for i := range def.SpecialTiles {
-				prependTexture(cc.mediaPool, &def.SpecialTiles[i].Texture)
+				prependTexture(p, &def.SpecialTiles[i].Texture)
 			}
-			prependTexture(cc.mediaPool, &def.Palette)
+			prependTexture(p, &def.Palette)
 			for k, v := range def.ConnectTo {
 				def.ConnectTo[k] = p0Map[cc.name][v]
 			}
-			prepend(cc.mediaPool, &def.FlowingAlt)
-			prepend(cc.mediaPool, &def.SrcAlt)
-			prepend(cc.mediaPool, &def.FootstepSnd.Name)
-			prepend(cc.mediaPool, &def.DiggingSnd.Name)
-			prepend(cc.mediaPool, &def.DugSnd.Name)
-			prepend(cc.mediaPool, &def.DigPredict)
+			prepend(p, &def.FlowingAlt)
+			prepend(p, &def.SrcAlt)
+			prepend(p, &def.FootstepSnd.Name)
+			prepend(p, &def.DiggingSnd.Name)
+			prepend(p, &def.DugSnd.Name)
+			prepend(p, &def.DigPredict)
 			nodeDefs = append(nodeDefs, def)
 
 			param0++
@@ -492,18 +533,63 @@ func muxNodeDefs(conns []*contentConn) (nodeDefs []mt.NodeDef, p0Map param0Map,
 	return
 }
 
-func muxMedia(conns []*contentConn) []mediaFile {
-	var media []mediaFile
+// muxMedia returns the media of all pools. Identical files
+// are only included once. The aliases map the names
+// of the omitted files to the name of the file that is kept.
+func muxMedia(conns []*contentConn, names *contentNames) ([]mediaFile, map[string]string) {
+	var all []mediaFile
 
 	for _, cc := range conns {
 		<-cc.done()
 		for _, f := range cc.media {
-			prepend(cc.mediaPool, &f.name)
-			media = append(media, f)
+			f.name = names.prefixNameRaw(cc.mediaPool, f.name)
+			all = append(all, f)
+		}
+	}
+
+	// Pick the same name every time so that the aliases
+	// don't depend on the order of the pools.
+	canonical := make(map[string]string)
+	for _, f := range all {
+		if !dedupable(f) {
+			continue
+		}
+
+		if name, ok := canonical[f.base64SHA1]; !ok || f.name < name {
+			canonical[f.base64SHA1] = f.name
+		}
+	}
+
+	var media []mediaFile
+	aliases := make(map[string]string)
+
+	for _, f := range all {
+		if dedupable(f) && canonical[f.base64SHA1] != f.name {
+			aliases[f.name] = canonical[f.base64SHA1]
+			continue
 		}
+
+		media = append(media, f)
 	}
 
-	return media
+	return media, aliases
+}
+
+// dedupable reports whether a media file may be replaced
+// with an identical file of a different name.
+// This is only the case for files that are referenced
+// by their full name, i.e. not for sounds or translations.
+func dedupable(f mediaFile) bool {
+	if f.base64SHA1 == "" {
+		return false
+	}
+
+	switch path.Ext(f.name) {
+	case ".png", ".jpg", ".jpeg", ".tga", ".bmp", ".obj", ".b3d", ".x", ".gltf", ".glb":
+		return true
+	}
+
+	return false
 }
 
 func muxRemotes(conns []*contentConn) []string {
@@ -524,9 +610,23 @@ func muxRemotes(conns []*contentConn) []string {
 	return urls
 }
 
-func muxContent(userName string) (denyPools map[string]struct{}, itemDefs []mt.ItemDef, aliases []struct{ Alias, Orig string }, nodeDefs []mt.NodeDef, p0Map param0Map, p0SrvMap param0SrvMap, media []mediaFile, remotes []string, err error) {
+func muxPoolHashes(conns []*contentConn) map[string]string {
+	hashes := make(map[string]string)
+
+	for _, cc := range conns {
+		<-cc.done()
+		if cc.success {
+			hashes[cc.mediaPool] = contentHashSum(cc.contentHash)
+		}
+	}
+
+	return hashes
+}
+
+func muxContent(userName string) (*muxResult, error) {
 	var conns []*contentConn
-	denyPools = make(map[string]struct{})
+	var err error
+	denyPools := make(map[string]struct{})
 
 PoolLoop:
 	for poolName, pool := range Conf().Pools() {
@@ -558,17 +658,44 @@ PoolLoop:
 		denyPools[poolName] = struct{}{}
 	}
 
+	mux := &muxResult{}
+
 	failedPools := muxErrors(conns)
-	itemDefs, aliases = muxItemDefs(conns)
-	nodeDefs, p0Map, p0SrvMap = muxNodeDefs(conns)
-	media = muxMedia(conns)
-	remotes = muxRemotes(conns)
+
+	// Media aliases and shared names need to be known
+	// before any names are prefixed.
+	// The naming settings are fixed for the clients of this run
+	// so that reloading the config doesn't rename their content.
+	names := &contentNames{namings: poolNamings(Conf())}
+	mux.media, names.mediaAliases = muxMedia(conns, names)
+	names.sharedNames = muxShared(conns)
+
+	names.setSrvNames(conns)
+
+	mux.names = names
+	mux.itemDefs, mux.aliases = muxItemDefs(conns, names)
+	mux.nodeDefs, mux.p0Map, mux.p0SrvMap = muxNodeDefs(conns, names)
+	mux.remotes = muxRemotes(conns)
+	mux.poolHashes = muxPoolHashes(conns)
 
 	for pool := range failedPools {
 		denyPools[pool] = struct{}{}
 	}
+	mux.denyPools = denyPools
 
-	return
+	// The report needs to know which pools failed.
+	muxReport(conns, mux)
+
+	// Ownership is only complete if all pools were fetched.
+	if Conf().MediaCache.GC && len(denyPools) == 0 {
+		if n, freed, err := GCCache(); err != nil {
+			log.Print("media cache gc: ", err)
+		} else if n > 0 {
+			log.Printf("media cache gc: removed %d files (%d bytes)", n, freed)
+		}
+	}
+
+	return mux, err
 }
 
 func (sc *ServerConn) globalParam0(p0 *mt.Content) {
@@ -607,41 +734,97 @@ func isDefaultNode(s string) bool {
 	return false
 }
 
-func prependRaw(prep string, s *string, isTexture bool) {
-	if !isDefaultNode(*s) {
-		subs := disallowedChars.Split(*s, -1)
-		seps := disallowedChars.FindAllString(*s, -1)
+// contentNames holds the state of a multiplexing run
+// that determines the names clients see.
+// Clients keep the contentNames their content was multiplexed with
+// so that later runs don't change names they already know.
+// It must not be modified once it has been assigned to a muxResult.
+type contentNames struct {
+	// mediaAliases maps the names of deduplicated media files
+	// to the names of the files that replace them.
+	mediaAliases map[string]string
+	// sharedNames maps media pools to the names
+	// of shared mods they don't prefix.
+	sharedNames map[string]map[string]struct{}
+	// namings maps media pools to their naming settings.
+	namings map[string]poolNaming
+	// srvNames maps media pools to the names of their nodes,
+	// items and aliases on the client to the names on the server.
+	srvNames map[string]map[string]string
+}
 
-		for i, sub := range subs {
-			if !isTexture || strings.Contains(sub, ".") {
-				subs[i] = prep + "_" + sub
-			}
-		}
+// mediaAlias returns the name of the media file
+// that replaces the specified file if it is a duplicate.
+// Otherwise it returns the input string.
+func (n *contentNames) mediaAlias(name string) string {
+	if n == nil {
+		return name
+	}
 
-		*s = ""
-		for i, sub := range subs {
-			*s += sub
-			if i < len(seps) {
-				*s += seps[i]
-			}
-		}
+	if alias, ok := n.mediaAliases[name]; ok {
+		return alias
+	}
+
+	return name
+}
+
+// A prefixer prefixes the names of a media pool
+// as seen by the clients using its contentNames.
+type prefixer struct {
+	names *contentNames
+	pool  string
+}
+
+func (n *contentNames) prefixer(pool string) prefixer {
+	return prefixer{names: n, pool: pool}
+}
+
+// clientNames returns the contentNames of the client of the ServerConn.
+// It is nil if there is no client.
+func (sc *ServerConn) clientNames() *contentNames {
+	if clt := sc.client(); clt != nil {
+		return clt.names
 	}
+
+	return nil
+}
+
+// prefixer returns the prefixer for the content of the ServerConn.
+func (sc *ServerConn) prefixer() prefixer {
+	return sc.clientNames().prefixer(sc.mediaPool)
+}
+
+// prepend prefixes a node, item, sound or media file name
+// according to the naming settings of a media pool.
+// Builtin nodes, names of shared mods and exempt names
+// are left untouched.
+func prepend(p prefixer, s *string) {
+	*s = p.name(*s)
 }
 
-func prepend(prep string, s *string) {
-	prependRaw(prep, s, false)
+// prependItemString prefixes the item name of an item string
+// with the name of a media pool.
+func prependItemString(p prefixer, s *string) {
+	name, rest, ok := strings.Cut(*s, " ")
+
+	prepend(p, &name)
+	if ok {
+		name += " " + rest
+	}
+
+	*s = name
 }
 
-func prependTexture(prep string, t *mt.Texture) {
-	s := string(*t)
-	prependRaw(prep, &s, true)
-	*t = mt.Texture(s)
+// prependTexture prefixes all media files referenced
+// by a texture with the name of a media pool.
+func prependTexture(p prefixer, t *mt.Texture) {
+	*t = mt.Texture(prependTextureString(p, string(*t)))
 }
 
 func (sc *ServerConn) prependInv(inv mt.Inv) {
 	for k, l := range inv {
 		for i := range l.Stacks {
-			prepend(sc.mediaPool, &inv[k].InvList.Stacks[i].Name)
+			prepend(sc.prefixer(), &inv[k].InvList.Stacks[i].Name)
 		}
 	}
 }
@@ -650,28 +833,28 @@ func (sc *ServerConn) prependHUD(t mt.HUDType, cmdIface mt.ToCltCmd) {
 	pa := func(cmd *mt.ToCltAddHUD) {
 		switch t {
 		case mt.StatbarHUD:
-			prepend(sc.mediaPool, &cmd.Text2)
+			cmd.Text2 = prependTextureString(sc.prefixer(), cmd.Text2)
 			fallthrough
 		case mt.ImgHUD:
 			fallthrough
 		case mt.ImgWaypointHUD:
 			fallthrough
 		case mt.ImgWaypointHUD + 1:
-			prepend(sc.mediaPool, &cmd.Text)
+			cmd.Text = prependTextureString(sc.prefixer(), cmd.Text)
 		}
 	}
 
 	pc := func(cmd *mt.ToCltChangeHUD) {
 		switch t {
 		case mt.StatbarHUD:
-			prepend(sc.mediaPool, &cmd.Text2)
+			cmd.Text2 = prependTextureString(sc.prefixer(), cmd.Text2)
 			fallthrough
 		case mt.ImgHUD:
 			fallthrough
 		case mt.ImgWaypointHUD:
 			fallthrough
 		case mt.ImgWaypointHUD + 1:
-			prepend(sc.mediaPool, &cmd.Text)
+			cmd.Text = prependTextureString(sc.prefixer(), cmd.Text)
 		}
 	}
 
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"log"
+	"sync"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// A muxResult is the multiplexed content of all media pools.
+// It is shared by all clients and must not be modified.
+type muxResult struct {
+	denyPools map[string]struct{}
+	itemDefs  []mt.ItemDef
+	aliases   []struct{ Alias, Orig string }
+	nodeDefs  []mt.NodeDef
+	p0Map     param0Map
+	p0SrvMap  param0SrvMap
+	media     []mediaFile
+	remotes   []string
+	names     *contentNames
+
+	// poolHashes maps media pool names to the hash
+	// of the content they sent.
+	poolHashes map[string]string
+}
+
+var (
+	contentCache    *muxResult
+	contentCacheGen uint64
+	contentCacheMu  sync.Mutex
+
+	// contentFetchMu makes sure that only one client
+	// fetches the content if the cache is empty.
+	contentFetchMu sync.Mutex
+)
+
+// FlushContentCache discards the cached multiplexed content.
+// It is fetched from the media pools again
+// when the next client connects.
+// Clients that are already connected are not affected.
+func FlushContentCache() {
+	contentCacheMu.Lock()
+	defer contentCacheMu.Unlock()
+
+	contentCache = nil
+	contentCacheGen++
+}
+
+// cachedMuxContent returns the cached multiplexed content
+// or fetches it if the cache is empty.
+// Results with unreachable media pools are not cached.
+func cachedMuxContent(userName string) (*muxResult, error) {
+	contentFetchMu.Lock()
+	defer contentFetchMu.Unlock()
+
+	contentCacheMu.Lock()
+	if contentCache != nil {
+		defer contentCacheMu.Unlock()
+		return contentCache, nil
+	}
+
+	gen := contentCacheGen
+	contentCacheMu.Unlock()
+
+	mux, err := muxContent(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	contentCacheMu.Lock()
+	defer contentCacheMu.Unlock()
+
+	if gen == contentCacheGen && len(mux.denyPools) == 0 {
+		contentCache = mux
+	}
+
+	return mux, nil
+}
+
+// checkContentHash flushes the content cache if the content hash
+// of a media pool differs from the cached one.
+func checkContentHash(pool, sum string) {
+	contentCacheMu.Lock()
+	defer contentCacheMu.Unlock()
+
+	if contentCache == nil {
+		return
+	}
+
+	if cached, ok := contentCache.poolHashes[pool]; ok && cached == sum {
+		return
+	}
+
+	log.Print("content of media pool ", pool, " changed, flushing content cache")
+
+	contentCache = nil
+	contentCacheGen++
+}
+
+func newContentHash() hash.Hash { return sha1.New() }
+
+// hashContent adds a content packet to a content hash.
+// The packets have to be added in the order they are received in.
+func hashContent(h hash.Hash, cmd mt.Cmd) {
+	fmt.Fprintf(h, "%T%v", cmd, cmd)
+}
+
+func contentHashSum(h hash.Hash) string {
+	return b64.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// CtlChannel is the name of the mod channel the proxy uses
+// to communicate with mods running on the upstream servers.
+// Clients are not allowed to join it.
+// See doc/ctlchannel.md for the protocol.
+const CtlChannel = "mt_multiserver_proxy"
+
+var (
+	ErrCtlChannelNotJoined = errors.New("control channel not joined")
+	ErrUnknownCtlRequest   = errors.New("unknown control channel request type")
+	ErrUntrustedServer     = errors.New("server not trusted")
+)
+
+// publicCtlRequests are the request types untrusted servers may send.
+// They don't change any state.
+var publicCtlRequests = map[string]struct{}{
+	"players": {},
+	"servers": {},
+}
+
+// ctlRequest is the common part of all requests
+// received on the control channel.
+type ctlRequest struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Player string `json:"player"`
+}
+
+type ctlReply struct {
+	Type   string      `json:"type"`
+	ID     int64       `json:"id"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+type ctlEvent struct {
+	Type   string `json:"type"`
+	Event  string `json:"event"`
+	Player string `json:"player"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+type ctlServerInfo struct {
+	Name    string   `json:"name"`
+	Groups  []string `json:"groups"`
+	Players int      `json:"players"`
+}
+
+// joinCtlChannel requests to join the control channel.
+// It must be called after the ServerConn is ready.
+func (sc *ServerConn) joinCtlChannel() {
+	sc.SendCmd(&mt.ToSrvJoinModChan{Channel: CtlChannel})
+}
+
+// ctlChannelJoined reports whether the upstream server
+// has accepted the control channel join request.
+func (sc *ServerConn) ctlChannelJoined() bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	return sc.ctlJoined
+}
+
+// sendCtlMsg sends a JSON encoded message on the control channel.
+// The sender of the message is the player name of the ServerConn.
+func (sc *ServerConn) sendCtlMsg(msg interface{}) error {
+	if !sc.ctlChannelJoined() {
+		return ErrCtlChannelNotJoined
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = sc.SendCmd(&mt.ToSrvMsgModChan{
+		Channel: CtlChannel,
+		Msg:     string(b),
+	})
+	return err
+}
+
+// handleCtlChannelSig processes a signal for the control channel.
+func (sc *ServerConn) handleCtlChannelSig(cmd *mt.ToCltModChanSig) {
+	switch cmd.Signal {
+	case mt.JoinOK:
+		sc.mu.Lock()
+		sc.ctlJoined = true
+		sc.mu.Unlock()
+
+		sc.Log("<-", "join control channel")
+		go sc.syncPrivs()
+		go sc.deliverHandoff()
+	case mt.JoinFail:
+		sc.Log("<-", "control channel unavailable")
+	case mt.LeaveOK:
+		sc.mu.Lock()
+		sc.ctlJoined = false
+		sc.mu.Unlock()
+	}
+}
+
+// handleCtlMsg processes a message received on the control channel.
+// Requests are only processed by the ServerConn of the player
+// they are addressed to, so that a message sent to all members
+// of the channel is handled exactly once.
+// Untrusted servers may only send requests that don't change any state.
+func (sc *ServerConn) handleCtlMsg(msg string) {
+	clt := sc.client()
+	if clt == nil {
+		return
+	}
+
+	var req ctlRequest
+	if err := json.Unmarshal([]byte(msg), &req); err != nil {
+		return
+	}
+
+	if req.Player != clt.Name() || req.Type == "reply" || req.Type == "event" {
+		return
+	}
+
+	sc.Log("<-", "control request", req.Type)
+
+	reply := ctlReply{
+		Type: "reply",
+		ID:   req.ID,
+	}
+
+	_, public := publicCtlRequests[req.Type]
+	trusted := Conf().Servers[sc.name].Trusted
+
+	handler, ok := ctlHandler(req.Type)
+	if !ok {
+		reply.Error = ErrUnknownCtlRequest.Error()
+	} else if !public && !trusted {
+		sc.Log("<-", "deny control request from untrusted server")
+		reply.Error = ErrUntrustedServer.Error()
+	} else if result, err := handler(clt, json.RawMessage(msg)); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.Result = result
+	}
+
+	if err := sc.sendCtlMsg(reply); err != nil {
+		sc.Log("->", "control reply:", err)
+	}
+}
+
+// broadcastCtlEvent sends an event to the control channel
+// of every server at least one player is connected to.
+func broadcastCtlEvent(ev ctlEvent) {
+	ev.Type = "event"
+
+	sent := make(map[string]struct{})
+	for cc := range Clts() {
+		sc := cc.server()
+		if sc == nil || !sc.ctlChannelJoined() {
+			continue
+		}
+
+		if _, ok := sent[sc.name]; ok {
+			continue
+		}
+
+		if err := sc.sendCtlMsg(ev); err == nil {
+			sent[sc.name] = struct{}{}
+		}
+	}
+}
+
+func init() {
+	RegisterCtlHandler("hop", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		var req struct {
+			Server string `json:"server"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+
+		go func() {
+			if err := cc.Hop(req.Server); err != nil {
+				cc.Log("<-", "control hop:", err)
+				cc.SendChatMsg("Could not switch servers. Error:", err.Error())
+			}
+		}()
+
+		return nil, nil
+	})
+
+	RegisterCtlHandler("hop_group", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		var req struct {
+			Group string `json:"group"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+
+		go func() {
+			if err := cc.HopGroup(req.Group); err != nil {
+				cc.Log("<-", "control hop:", err)
+				cc.SendChatMsg("Could not switch servers. Error:", err.Error())
+			}
+		}()
+
+		return nil, nil
+	})
+
+	RegisterCtlHandler("players", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		players := make(map[string]string)
+		for clt := range Clts() {
+			if clt.Name() != "" {
+				players[clt.Name()] = clt.ServerName()
+			}
+		}
+
+		return players, nil
+	})
+
+	RegisterCtlHandler("servers", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		counts := make(map[string]int)
+		for clt := range Clts() {
+			counts[clt.ServerName()]++
+		}
+
+		var servers []ctlServerInfo
+		for name, srv := range Conf().Servers {
+			servers = append(servers, ctlServerInfo{
+				Name:    name,
+				Groups:  srv.Groups,
+				Players: counts[name],
+			})
+		}
+
+		sort.Slice(servers, func(i, j int) bool {
+			return servers[i].Name < servers[j].Name
+		})
+
+		return servers, nil
+	})
+
+	RegisterCtlHandler("msg", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		var req struct {
+			Msg     string   `json:"msg"`
+			Servers []string `json:"servers"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+
+		for clt := range Clts() {
+			if len(req.Servers) > 0 && !slices.Contains(req.Servers, clt.ServerName()) {
+				continue
+			}
+
+			clt.SendChatMsg(strings.TrimSpace(req.Msg))
+		}
+
+		return nil, nil
+	})
+
+	RegisterOnAuth(func(cc *ClientConn) {
+		broadcastCtlEvent(ctlEvent{Event: "join", Player: cc.Name()})
+	})
+
+	RegisterOnLeave(func(cc *ClientConn, lt LeaveType) {
+		broadcastCtlEvent(ctlEvent{Event: "leave", Player: cc.Name()})
+	})
+
+	RegisterOnHopDone(func(cc *ClientConn, from, to string) {
+		broadcastCtlEvent(ctlEvent{
+			Event:  "hop",
+			Player: cc.Name(),
+			From:   from,
+			To:     to,
+		})
+	})
+}
@@ -0,0 +1,297 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"errors"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+var (
+	ErrMediaExists = errors.New("media file with this name already exists")
+)
+
+// A dynMediaFile is a media file that has been pushed to a client
+// after the initial media announcement.
+type dynMediaFile struct {
+	sha1 [sha1.Size]byte
+	// srv is the server that pushed the file.
+	// It is empty if the file has been pushed by a plugin.
+	srv       string
+	ephemeral bool
+	// data is only kept until the client has the file.
+	data []byte
+}
+
+// A dynMediaToken maps a callback token of the proxy
+// to the one of the server that pushed the file.
+type dynMediaToken struct {
+	name   string
+	srv    string
+	srvTok uint32
+	done   chan struct{}
+}
+
+// A dynMediaReq is a dynamic media file
+// that has been requested from a server.
+type dynMediaReq struct {
+	sha1      [sha1.Size]byte
+	token     uint32
+	ephemeral bool
+}
+
+// PushMedia sends a media file to the ClientConn
+// after the initial media announcement.
+// The name isn't prefixed and must not be used by any other media file.
+// Ephemeral files aren't cached by the client and are forgotten
+// by the proxy when the player leaves the current server.
+// The returned channel is closed when the client has received the file.
+func (cc *ClientConn) PushMedia(name string, data []byte, ephemeral bool) (<-chan struct{}, error) {
+	if cc.isStaticMedia(name) {
+		return nil, ErrMediaExists
+	}
+
+	sum := sha1.Sum(data)
+
+	// The check and the insertion must not be interrupted
+	// so that concurrent pushes of the same name can't both succeed.
+	cc.dynMediaMu.Lock()
+
+	if f, ok := cc.dynMedia[name]; ok {
+		cc.dynMediaMu.Unlock()
+
+		if f.sha1 != sum {
+			return nil, ErrMediaExists
+		}
+
+		done := make(chan struct{})
+		close(done)
+
+		return done, nil
+	}
+
+	token, done := cc.addDynMedia(name, sum, data, "", 0, ephemeral)
+	cc.dynMediaMu.Unlock()
+
+	cc.sendMediaPush(name, sum, token, ephemeral)
+	return done, nil
+}
+
+// pushMedia announces a dynamic media file to the client.
+// The data is sent when the client requests it.
+func (cc *ClientConn) pushMedia(name string, sum [sha1.Size]byte, data []byte, srv string, srvTok uint32, ephemeral bool) chan struct{} {
+	cc.dynMediaMu.Lock()
+	token, done := cc.addDynMedia(name, sum, data, srv, srvTok, ephemeral)
+	cc.dynMediaMu.Unlock()
+
+	cc.sendMediaPush(name, sum, token, ephemeral)
+	return done
+}
+
+// addDynMedia records a dynamic media file and returns
+// the callback token to announce it with.
+// The caller must hold dynMediaMu.
+func (cc *ClientConn) addDynMedia(name string, sum [sha1.Size]byte, data []byte, srv string, srvTok uint32, ephemeral bool) (uint32, chan struct{}) {
+	done := make(chan struct{})
+
+	cc.dynMedia[name] = &dynMediaFile{
+		sha1:      sum,
+		srv:       srv,
+		ephemeral: ephemeral,
+		data:      data,
+	}
+
+	cc.dynMediaToken++
+	token := cc.dynMediaToken
+	cc.dynMediaTokens[token] = dynMediaToken{
+		name:   name,
+		srv:    srv,
+		srvTok: srvTok,
+		done:   done,
+	}
+
+	return token, done
+}
+
+// sendMediaPush announces a recorded dynamic media file to the client.
+func (cc *ClientConn) sendMediaPush(name string, sum [sha1.Size]byte, token uint32, ephemeral bool) {
+	cc.SendCmd(&mt.ToCltMediaPush{
+		SHA1:          sum,
+		Filename:      name,
+		CallbackToken: token,
+		ShouldCache:   !ephemeral,
+	})
+}
+
+// haveDynMedia handles the confirmation of dynamic media files
+// by the client and forwards it to the servers that pushed them.
+func (cc *ClientConn) haveDynMedia(tokens []uint32) {
+	srv := cc.server()
+	var srvToks []uint32
+
+	cc.dynMediaMu.Lock()
+
+	for _, token := range tokens {
+		t, ok := cc.dynMediaTokens[token]
+		if !ok {
+			continue
+		}
+
+		delete(cc.dynMediaTokens, token)
+		close(t.done)
+
+		if f, ok := cc.dynMedia[t.name]; ok {
+			f.data = nil
+		}
+
+		if t.srv != "" && srv != nil && srv.name == t.srv {
+			srvToks = append(srvToks, t.srvTok)
+		}
+	}
+
+	cc.dynMediaMu.Unlock()
+
+	if len(srvToks) > 0 {
+		srv.SendCmd(&mt.ToSrvHaveMedia{Tokens: srvToks})
+	}
+}
+
+// dynMediaData returns the content of a dynamic media file
+// the client hasn't received yet.
+func (cc *ClientConn) dynMediaData(name string) ([]byte, bool) {
+	cc.dynMediaMu.Lock()
+	defer cc.dynMediaMu.Unlock()
+
+	f, ok := cc.dynMedia[name]
+	if !ok || f.data == nil {
+		return nil, false
+	}
+
+	return f.data, true
+}
+
+// hasDynMedia reports whether the client already has
+// a dynamic media file with the specified name and hash.
+// The file is reassigned to the server so that
+// it isn't forgotten when the player leaves another server.
+func (cc *ClientConn) hasDynMedia(name string, sum [sha1.Size]byte, srv string, ephemeral bool) bool {
+	cc.dynMediaMu.Lock()
+	defer cc.dynMediaMu.Unlock()
+
+	f, ok := cc.dynMedia[name]
+	if !ok || f.sha1 != sum {
+		return false
+	}
+
+	f.srv = srv
+	f.ephemeral = f.ephemeral && ephemeral
+
+	return true
+}
+
+// forgetDynMedia forgets the ephemeral media files of a server
+// the player has left and of plugins as well as the
+// unconfirmed callback tokens of the server
+// along with their files.
+// The client keeps the files until it disconnects,
+// but the proxy doesn't consider them present anymore
+// so that they are pushed again if needed.
+func (cc *ClientConn) forgetDynMedia(srv string) {
+	cc.dynMediaMu.Lock()
+	defer cc.dynMediaMu.Unlock()
+
+	for name, f := range cc.dynMedia {
+		if f.ephemeral && (f.srv == srv || f.srv == "") {
+			delete(cc.dynMedia, name)
+		}
+	}
+
+	for token, t := range cc.dynMediaTokens {
+		if t.srv == srv {
+			delete(cc.dynMediaTokens, token)
+
+			// The data would never be released otherwise.
+			// The client may not have the file,
+			// so it has to be pushed again if needed.
+			if f, ok := cc.dynMedia[t.name]; ok {
+				f.data = nil
+				delete(cc.dynMedia, t.name)
+			}
+		}
+	}
+}
+
+// isStaticMedia reports whether a media file with the specified name
+// has been announced to the client during the initial media transfer.
+func (cc *ClientConn) isStaticMedia(name string) bool {
+	for _, f := range cc.media {
+		if f.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleMediaPush handles a dynamic media file pushed by the server.
+// Files the client already has are confirmed right away,
+// files in the media cache are pushed to the client directly
+// and all other files are requested from the server first.
+func (sc *ServerConn) handleMediaPush(cmd *mt.ToCltMediaPush) {
+	clt := sc.client()
+	name := cmd.Filename
+	prepend(sc.prefixer(), &name)
+
+	if clt.isStaticMedia(name) || clt.hasDynMedia(name, cmd.SHA1, sc.name, !cmd.ShouldCache) {
+		sc.SendCmd(&mt.ToSrvHaveMedia{Tokens: []uint32{cmd.CallbackToken}})
+		return
+	}
+
+	if data, err := readCache(b64.EncodeToString(cmd.SHA1[:]), true); err == nil {
+		clt.pushMedia(name, cmd.SHA1, data, sc.name, cmd.CallbackToken, !cmd.ShouldCache)
+		return
+	}
+
+	sc.dynMediaReqs[cmd.Filename] = dynMediaReq{
+		sha1:      cmd.SHA1,
+		token:     cmd.CallbackToken,
+		ephemeral: !cmd.ShouldCache,
+	}
+
+	sc.SendCmd(&mt.ToSrvReqMedia{Filenames: []string{cmd.Filename}})
+}
+
+// handleDynMedia handles dynamic media files
+// that have been requested from the server.
+func (sc *ServerConn) handleDynMedia(files []struct {
+	Name string
+	Data []byte
+}) {
+	clt := sc.client()
+
+	for _, f := range files {
+		req, ok := sc.dynMediaReqs[f.Name]
+		if !ok {
+			sc.Log("<-", "unrequested media file", f.Name)
+			continue
+		}
+
+		delete(sc.dynMediaReqs, f.Name)
+
+		sum := sha1.Sum(f.Data)
+		if sum != req.sha1 {
+			sc.Log("<-", "media file", f.Name, "doesn't match its hash")
+		}
+
+		if !req.ephemeral {
+			if err := cacheMedia(sc.mediaPool, f.Data, true); err != nil {
+				sc.Log("<-", "cache", err)
+			}
+		}
+
+		name := f.Name
+		prepend(sc.prefixer(), &name)
+
+		clt.pushMedia(name, sum, f.Data, sc.name, req.token, req.ephemeral)
+	}
+}
@@ -2,36 +2,242 @@ package proxy
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
-var itemName = regexp.MustCompile("(item_image\\[[0-9.]+,[0-9.]+;[0-9.]+,[0-9]+;)([a-zA-Z0-9-_.: ]+)(\\])")
-var itemButtonName = regexp.MustCompile("(item_image_button\\[[0-9.]+,[0-9.]+;[0-9.]+,[0-9.]+;)([a-zA-Z0-9-_.: ]+)(;[a-zA-Z0-9-_.: ]+;[^\\[\\]]*\\])")
-var textureName = regexp.MustCompile("[a-zA-Z0-9-_.]*\\.[a-zA-Z-_.]+")
+// A formspecElem is an element of a formspec, e.g. `image[0,0;1,1;a.png]`.
+// The arguments are still escaped.
+type formspecElem struct {
+	name string
+	args []string
+}
 
-func (sc *ServerConn) prependFormspec(fs *string) {
-	subs := disallowedChars.Split(*fs, -1)
-	seps := disallowedChars.FindAllString(*fs, -1)
+func (e formspecElem) String() string {
+	return e.name + "[" + strings.Join(e.args, ";") + "]"
+}
+
+// formspecTextureArgs maps formspec element names to the indices
+// of their arguments that are textures.
+var formspecTextureArgs = map[string][]int{
+	"image":             {2},
+	"animated_image":    {3},
+	"background":        {2},
+	"background9":       {2},
+	"image_button":      {2, 7},
+	"image_button_exit": {2, 7},
+}
+
+// formspecItemArgs maps formspec element names to the indices
+// of their arguments that are item names.
+var formspecItemArgs = map[string][]int{
+	"item_image":        {2},
+	"item_image_button": {2},
+}
+
+// formspecStyleTextures are the style properties that are textures.
+var formspecStyleTextures = map[string]struct{}{
+	"bgimg":         {},
+	"bgimg_hovered": {},
+	"bgimg_pressed": {},
+	"fgimg":         {},
+	"fgimg_hovered": {},
+	"fgimg_pressed": {},
+}
+
+// hypertextTag matches the name attribute of img and item tags in hypertext.
+var hypertextTag = regexp.MustCompile(`(<(?:img|item)\s+(?:[^>]*\s)?name=)([^\s>]+)`)
+
+// parseFormspec splits a formspec into its elements.
+// The text between elements (usually whitespace) is returned
+// in between, so that seps has one more entry than elems.
+func parseFormspec(fs string) (elems []formspecElem, seps []string) {
+	start := 0
+	for start < len(fs) {
+		open := strings.IndexByte(fs[start:], '[')
+		if open < 0 {
+			break
+		}
+		open += start
+
+		nameStart := strings.LastIndexAny(fs[start:open], " \t\r\n") + 1 + start
+		sep := fs[start:nameStart]
+		name := fs[nameStart:open]
 
-	for i, sub := range subs {
-		if textureName.MatchString(sub) && !strings.Contains(sub, " ") {
-			prepend(sc.mediaPool, &subs[i])
+		var args []string
+		argStart := open + 1
+		end := -1
+
+	ArgLoop:
+		for i := open + 1; i < len(fs); i++ {
+			switch fs[i] {
+			case '\\':
+				i++
+			case ';':
+				args = append(args, fs[argStart:i])
+				argStart = i + 1
+			case ']':
+				args = append(args, fs[argStart:i])
+				end = i
+				break ArgLoop
+			}
+		}
+
+		if end < 0 {
+			break
 		}
+
+		seps = append(seps, sep)
+		elems = append(elems, formspecElem{name: name, args: args})
+		start = end + 1
 	}
 
-	*fs = ""
-	for i, sub := range subs {
-		*fs += sub
-		if i < len(seps) {
-			*fs += seps[i]
+	return elems, append(seps, fs[start:])
+}
+
+// formspecUnescape removes formspec escaping.
+func formspecUnescape(s string) string {
+	return textureUnescape(s)
+}
+
+// formspecEscape applies formspec escaping.
+func formspecEscape(s string) string {
+	return textureEscape(s, "\\[];,$")
+}
+
+// splitFormspecArg splits an escaped formspec argument
+// at every unescaped occurence of sep.
+func splitFormspecArg(arg string, sep byte) []string {
+	var parts []string
+
+	start := 0
+	for i := 0; i < len(arg); i++ {
+		switch arg[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, arg[start:i])
+			start = i + 1
 		}
 	}
 
-	*fs = ReplaceAllStringSubmatchFunc(itemName, *fs, func(groups []string) string {
-		return groups[1] + sc.name + "_" + groups[2] + groups[3]
-	})
-	*fs = ReplaceAllStringSubmatchFunc(itemButtonName, *fs, func(groups []string) string {
-		return groups[1] + sc.name + "_" + groups[2] + groups[3]
+	return append(parts, arg[start:])
+}
+
+// rewriteFormspecArg applies f to the unescaped value
+// of an escaped formspec argument.
+// The argument is only reescaped if it has changed.
+func rewriteFormspecArg(arg string, f func(string) string) string {
+	raw := formspecUnescape(arg)
+	rewritten := f(raw)
+	if rewritten == raw {
+		return arg
+	}
+
+	return formspecEscape(rewritten)
+}
+
+// rewriteFormspec rewrites all textures, item names and meshes
+// referenced by a formspec.
+func rewriteFormspec(fs string, texture, item, mesh func(string) string) string {
+	elems, seps := parseFormspec(fs)
+
+	for i := range elems {
+		elem := &elems[i]
+		args := elem.args
+
+		for _, idx := range formspecTextureArgs[elem.name] {
+			if idx < len(args) {
+				args[idx] = rewriteFormspecArg(args[idx], texture)
+			}
+		}
+
+		for _, idx := range formspecItemArgs[elem.name] {
+			if idx < len(args) {
+				args[idx] = rewriteFormspecArg(args[idx], item)
+			}
+		}
+
+		switch elem.name {
+		case "model":
+			// model[X,Y;W,H;name;mesh;textures;...]
+			if len(args) > 3 {
+				args[3] = rewriteFormspecArg(args[3], mesh)
+			}
+
+			if len(args) > 4 {
+				textures := splitFormspecArg(args[4], ',')
+				for j := range textures {
+					textures[j] = rewriteFormspecArg(textures[j], texture)
+				}
+
+				args[4] = strings.Join(textures, ",")
+			}
+		case "style", "style_type":
+			// style[selectors;prop=value;...]
+			for j := 1; j < len(args); j++ {
+				prop, value, ok := strings.Cut(args[j], "=")
+				if !ok {
+					continue
+				}
+
+				if _, ok := formspecStyleTextures[strings.TrimSpace(prop)]; ok {
+					args[j] = prop + "=" + rewriteFormspecArg(value, texture)
+				}
+			}
+		case "tablecolumns":
+			// tablecolumns[type,opt=value,...;...]
+			for j := range args {
+				opts := splitFormspecArg(args[j], ',')
+				if opts[0] != "image" {
+					continue
+				}
+
+				// Image columns map numbers to textures.
+				for k := 1; k < len(opts); k++ {
+					key, value, ok := strings.Cut(opts[k], "=")
+					if _, err := strconv.Atoi(key); ok && err == nil {
+						opts[k] = key + "=" + rewriteFormspecArg(value, texture)
+					}
+				}
+
+				args[j] = strings.Join(opts, ",")
+			}
+		case "hypertext":
+			// hypertext[X,Y;W,H;name;text]
+			if len(args) > 3 {
+				args[3] = rewriteFormspecArg(args[3], func(text string) string {
+					return ReplaceAllStringSubmatchFunc(hypertextTag, text, func(groups []string) string {
+						if strings.HasPrefix(groups[1], "<item") {
+							return groups[1] + item(groups[2])
+						}
+
+						return groups[1] + texture(groups[2])
+					})
+				})
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	for i, elem := range elems {
+		b.WriteString(seps[i])
+		b.WriteString(elem.String())
+	}
+	b.WriteString(seps[len(seps)-1])
+
+	return b.String()
+}
+
+func (sc *ServerConn) prependFormspec(fs *string) {
+	*fs = rewriteFormspec(*fs, func(t string) string {
+		return prependTextureString(sc.prefixer(), t)
+	}, func(item string) string {
+		prependItemString(sc.prefixer(), &item)
+		return item
+	}, func(mesh string) string {
+		prepend(sc.prefixer(), &mesh)
+		return mesh
 	})
 }
 
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseFormspec(t *testing.T) {
+	tests := []struct {
+		fs    string
+		elems []formspecElem
+		seps  []string
+	}{
+		{"", nil, []string{""}},
+		{"no elements", nil, []string{"no elements"}},
+		{
+			"size[8,9]",
+			[]formspecElem{{"size", []string{"8,9"}}},
+			[]string{"", ""},
+		},
+		{
+			"size[8,9]\n image[0,0;1,1;a.png] ",
+			[]formspecElem{
+				{"size", []string{"8,9"}},
+				{"image", []string{"0,0", "1,1", "a.png"}},
+			},
+			[]string{"", "\n ", " "},
+		},
+		{
+			`label[0,0;a\]b\;c\[d]`,
+			[]formspecElem{{"label", []string{"0,0", `a\]b\;c\[d`}}},
+			[]string{"", ""},
+		},
+		{
+			`label[0,0;a\\]`,
+			[]formspecElem{{"label", []string{"0,0", `a\\`}}},
+			[]string{"", ""},
+		},
+		{
+			"container_end[]",
+			[]formspecElem{{"container_end", []string{""}}},
+			[]string{"", ""},
+		},
+		{
+			"size[8,9]label[0,0;unterminated",
+			[]formspecElem{{"size", []string{"8,9"}}},
+			[]string{"", "label[0,0;unterminated"},
+		},
+		{
+			`label[0,0;a\]`,
+			nil,
+			[]string{`label[0,0;a\]`},
+		},
+	}
+
+	for _, tt := range tests {
+		elems, seps := parseFormspec(tt.fs)
+		if !reflect.DeepEqual(elems, tt.elems) || !slices.Equal(seps, tt.seps) {
+			t.Errorf("parseFormspec(%q) = %q, %q, want %q, %q", tt.fs, elems, seps, tt.elems, tt.seps)
+		}
+	}
+}
+
+func TestFormspecEscape(t *testing.T) {
+	tests := []struct {
+		raw, escaped string
+	}{
+		{"", ""},
+		{"a.png", "a.png"},
+		{`a[b]c;d,e\f$g`, `a\[b\]c\;d\,e\\f\$g`},
+		{"[combine:2x1:0,0=a.png", `\[combine:2x1:0\,0=a.png`},
+	}
+
+	for _, tt := range tests {
+		if got := formspecEscape(tt.raw); got != tt.escaped {
+			t.Errorf("formspecEscape(%q) = %q, want %q", tt.raw, got, tt.escaped)
+		}
+
+		if got := formspecUnescape(tt.escaped); got != tt.raw {
+			t.Errorf("formspecUnescape(%q) = %q, want %q", tt.escaped, got, tt.raw)
+		}
+	}
+}
+
+func TestSplitFormspecArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		sep  byte
+		want []string
+	}{
+		{"", ',', []string{""}},
+		{"a,b", ',', []string{"a", "b"}},
+		{`a,b\,c,d`, ',', []string{"a", `b\,c`, "d"}},
+		{`a\\,b`, ',', []string{`a\\`, "b"}},
+		{"a,", ',', []string{"a", ""}},
+		{`a\`, ',', []string{`a\`}},
+	}
+
+	for _, tt := range tests {
+		if got := splitFormspecArg(tt.arg, tt.sep); !slices.Equal(got, tt.want) {
+			t.Errorf("splitFormspecArg(%q, %q) = %q, want %q", tt.arg, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteFormspec(t *testing.T) {
+	texture := func(tex string) string {
+		return rewriteTexture(tex, func(file string) string {
+			return "t_" + file
+		})
+	}
+
+	item := func(name string) string {
+		return "i_" + name
+	}
+
+	mesh := func(name string) string {
+		return "m_" + name
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"size[8,9]", "size[8,9]"},
+		{"image[0,0;1,1;a.png]", "image[0,0;1,1;t_a.png]"},
+		{"size[8,9]\n image[0,0;1,1;a.png] ", "size[8,9]\n image[0,0;1,1;t_a.png] "},
+		{"image[0,0]", "image[0,0]"},
+		{
+			`image[0,0;1,1;[combine:2x1:0\,0=a.png:1\,0=b.png]`,
+			`image[0,0;1,1;\[combine:2x1:0\,0=t_a.png:1\,0=t_b.png]`,
+		},
+		{
+			`image[0,0;1,1;a.png^[colorize:#ff0000]`,
+			`image[0,0;1,1;t_a.png^\[colorize:#ff0000]`,
+		},
+		{
+			"animated_image[0,0;1,1;anim;a.png;4;100]",
+			"animated_image[0,0;1,1;anim;t_a.png;4;100]",
+		},
+		{
+			"image_button[0,0;1,1;a.png;btn;Label;true;false;b.png]",
+			"image_button[0,0;1,1;t_a.png;btn;Label;true;false;t_b.png]",
+		},
+		{
+			"item_image_button[0,0;1,1;default:stone;btn;]",
+			"item_image_button[0,0;1,1;i_default:stone;btn;]",
+		},
+		{
+			"model[0,0;1,1;m;a.b3d;a.png,b.png;0,0]",
+			"model[0,0;1,1;m;m_a.b3d;t_a.png,t_b.png;0,0]",
+		},
+		{
+			`model[0,0;1,1;m;a.b3d;[combine:2x1:0\,0=a.png,b.png]`,
+			`model[0,0;1,1;m;m_a.b3d;\[combine:2x1:0\,0=t_a.png,t_b.png]`,
+		},
+		{
+			"style[btn;bgimg=a.png;textcolor=red; fgimg=b.png]",
+			"style[btn;bgimg=t_a.png;textcolor=red; fgimg=t_b.png]",
+		},
+		{
+			"style_type[button;bgimg_hovered=a.png]",
+			"style_type[button;bgimg_hovered=t_a.png]",
+		},
+		{
+			"tablecolumns[image,align=left,1=a.png,2=b.png;text]",
+			"tablecolumns[image,align=left,1=t_a.png,2=t_b.png;text]",
+		},
+		{
+			"tablecolumns[text,1=a.png]",
+			"tablecolumns[text,1=a.png]",
+		},
+		{
+			"hypertext[0,0;1,1;h;<img name=a.png width=16> <item name=default:stone float=left>]",
+			"hypertext[0,0;1,1;h;<img name=t_a.png width=16> <item name=i_default:stone float=left>]",
+		},
+		{
+			"hypertext[0,0;1,1;h;<b>name=a.png</b>]",
+			"hypertext[0,0;1,1;h;<b>name=a.png</b>]",
+		},
+		{
+			`label[0,0;image\[0\,0\;1\,1\;a.png\]]`,
+			`label[0,0;image\[0\,0\;1\,1\;a.png\]]`,
+		},
+		{
+			"image[0,0;1,1;a.png]image[0,0;1,1;b.png",
+			"image[0,0;1,1;t_a.png]image[0,0;1,1;b.png",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := rewriteFormspec(tt.in, texture, item, mesh); got != tt.want {
+			t.Errorf("rewriteFormspec(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
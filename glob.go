@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// globToken is a single element of a pattern as understood by path.Match.
+type globToken struct {
+	star bool
+	// any is true for '?'.
+	any bool
+	// ranges are the character ranges of a literal or a class.
+	// A literal is a class with a single range.
+	ranges [][2]rune
+	negate bool
+}
+
+// matches reports whether the token matches a single rune.
+// Stars match any rune except for '/'.
+func (t globToken) matches(r rune) bool {
+	if t.star || t.any {
+		return r != '/'
+	}
+
+	in := false
+	for _, rng := range t.ranges {
+		if rng[0] <= r && r <= rng[1] {
+			in = true
+			break
+		}
+	}
+
+	return in != t.negate
+}
+
+// parseGlob splits a pattern into its tokens.
+// It returns path.ErrBadPattern if the pattern is malformed.
+func parseGlob(pattern string) ([]globToken, error) {
+	var tokens []globToken
+
+	// next returns the next (possibly escaped) rune of the pattern.
+	next := func() (rune, error) {
+		if pattern == "" {
+			return 0, path.ErrBadPattern
+		}
+
+		if pattern[0] == '\\' {
+			pattern = pattern[1:]
+			if pattern == "" {
+				return 0, path.ErrBadPattern
+			}
+		}
+
+		r, n := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[n:]
+
+		return r, nil
+	}
+
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = pattern[1:]
+
+			// Consecutive stars are equivalent to a single one.
+			if len(tokens) == 0 || !tokens[len(tokens)-1].star {
+				tokens = append(tokens, globToken{star: true})
+			}
+		case '?':
+			pattern = pattern[1:]
+			tokens = append(tokens, globToken{any: true})
+		case '[':
+			pattern = pattern[1:]
+
+			var t globToken
+			if strings.HasPrefix(pattern, "^") {
+				t.negate = true
+				pattern = pattern[1:]
+			}
+
+			for {
+				if pattern == "" {
+					return nil, path.ErrBadPattern
+				}
+
+				// Classes must not be empty.
+				if pattern[0] == ']' {
+					if len(t.ranges) == 0 {
+						return nil, path.ErrBadPattern
+					}
+
+					pattern = pattern[1:]
+					break
+				}
+
+				if pattern[0] == '-' {
+					return nil, path.ErrBadPattern
+				}
+
+				lo, err := next()
+				if err != nil {
+					return nil, err
+				}
+
+				hi := lo
+				if strings.HasPrefix(pattern, "-") {
+					pattern = pattern[1:]
+					if hi, err = next(); err != nil {
+						return nil, err
+					}
+
+					if hi < lo {
+						return nil, path.ErrBadPattern
+					}
+				}
+
+				t.ranges = append(t.ranges, [2]rune{lo, hi})
+			}
+
+			tokens = append(tokens, t)
+		default:
+			r, err := next()
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, globToken{ranges: [][2]rune{{r, r}}})
+		}
+	}
+
+	return tokens, nil
+}
+
+// tokensOverlap reports whether there is a rune
+// that is matched by both tokens.
+func tokensOverlap(a, b globToken) bool {
+	// If the sets of runes intersect, the intersection
+	// starts at the start or right after the end of a range
+	// or right after the excluded '/'.
+	candidates := []rune{0, '/' + 1}
+	for _, t := range []globToken{a, b} {
+		for _, rng := range t.ranges {
+			candidates = append(candidates, rng[0], rng[1]+1)
+		}
+	}
+
+	for _, r := range candidates {
+		if r <= utf8.MaxRune && a.matches(r) && b.matches(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globsOverlap reports whether there is a name that is matched
+// by both patterns. The patterns use the syntax of path.Match.
+func globsOverlap(pattern1, pattern2 string) (bool, error) {
+	a, err := parseGlob(pattern1)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := parseGlob(pattern2)
+	if err != nil {
+		return false, err
+	}
+
+	// This is a search of the product of the automatons
+	// of the patterns. visited prevents exponential runtime.
+	visited := make(map[[2]int]bool)
+
+	var overlap func(i, j int) bool
+	overlap = func(i, j int) bool {
+		if visited[[2]int{i, j}] {
+			return false
+		}
+		visited[[2]int{i, j}] = true
+
+		if i == len(a) && j == len(b) {
+			return true
+		}
+
+		// Stars may match the empty string.
+		if i < len(a) && a[i].star && overlap(i+1, j) {
+			return true
+		}
+
+		if j < len(b) && b[j].star && overlap(i, j+1) {
+			return true
+		}
+
+		if i == len(a) || j == len(b) || !tokensOverlap(a[i], b[j]) {
+			return false
+		}
+
+		// A star consuming a rune stays where it is.
+		nextI, nextJ := i+1, j+1
+		if a[i].star {
+			nextI = i
+		}
+
+		if b[j].star {
+			nextJ = j
+		}
+
+		if nextI == i && nextJ == j {
+			return false
+		}
+
+		return overlap(nextI, nextJ)
+	}
+
+	return overlap(0, 0), nil
+}
+
+// quoteGlob escapes the special characters of path.Match
+// so that the string only matches itself.
+func quoteGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', '\\':
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
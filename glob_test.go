@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestGlobsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"default:*", "default:*", true},
+		{"default:*", "default:stone", true},
+		{"default:*", "*:stone", true},
+		{"default:*", "farming:*", false},
+		{"default:*", "default_*", false},
+		{"*.ogg", "*.png", false},
+		{"*.ogg", "c_*", true},
+		{"*", "", true},
+		{"?", "", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"a*", "a/b", false},
+		{"[a-c]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"[^a-c]x", "bx", false},
+		{"[^a-c]x", "[^d-f]x", true},
+		{"[^a-z]", "[a-z]", false},
+		{"[a-c]", "[c-e]", true},
+		{"[a-c]", "[d-e]", false},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\[x`, "?x", true},
+		{"*a*b*", "*b*a*", true},
+		{"a*", "*b", true},
+		{"ab*", "*ba", true},
+		{"a", "ab", false},
+		{"世界*", "世?", true},
+	}
+
+	for _, tt := range tests {
+		for _, pair := range [][2]string{{tt.a, tt.b}, {tt.b, tt.a}} {
+			overlap, err := globsOverlap(pair[0], pair[1])
+			if err != nil {
+				t.Errorf("globsOverlap(%q, %q): %v", pair[0], pair[1], err)
+				continue
+			}
+
+			if overlap != tt.overlap {
+				t.Errorf("globsOverlap(%q, %q) = %v, want %v", pair[0], pair[1], overlap, tt.overlap)
+			}
+		}
+	}
+}
+
+func TestParseGlobMalformed(t *testing.T) {
+	for _, pattern := range []string{"[", "[a", "[]", "[^]", "a\\", "[a-", "[z-a]", "[-a]", "[a\\"} {
+		if _, err := parseGlob(pattern); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("parseGlob(%q): got error %v, want %v", pattern, err, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestQuoteGlob(t *testing.T) {
+	for _, s := range []string{"c_", "a*b", "a?b", "[x]", `a\b`} {
+		if ok, err := path.Match(quoteGlob(s), s); err != nil || !ok {
+			t.Errorf("path.Match(quoteGlob(%q), %q) = %v, %v", s, s, ok, err)
+		}
+
+		if ok, _ := path.Match(quoteGlob(s), s+"x"); ok {
+			t.Errorf("quoteGlob(%q) matches %q", s, s+"x")
+		}
+	}
+}
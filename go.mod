@@ -7,6 +7,7 @@ require (
 	github.com/HimbeerserverDE/srp v0.0.0
 	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.18
+	github.com/yuin/gopher-lua v1.1.1
 )
 
 require github.com/klauspost/compress v1.17.3 // indirect
@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"encoding/json"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// HandoffNamespace is the plugin storage namespace
+// handoff records are stored in if the `Storage` option
+// of the matching handoff rule is enabled.
+// The record of a player is stored under the key `record`.
+const HandoffNamespace = "handoff"
+
+// A Handoff holds state that is carried over from one server
+// to another when a player hops. Unselected state is omitted.
+type Handoff struct {
+	Type   string              `json:"type"`
+	From   string              `json:"from"`
+	To     string              `json:"to"`
+	Inv    map[string][]string `json:"inv,omitempty"`
+	HP     *uint16             `json:"hp,omitempty"`
+	Breath *uint16             `json:"breath,omitempty"`
+	Meta   map[string]string   `json:"meta,omitempty"`
+}
+
+// A HandoffRule selects the state that is carried over
+// when a player hops from one server to another.
+type HandoffRule struct {
+	From    string
+	To      string
+	State   []string
+	Storage bool
+}
+
+// handoffRule returns the first rule that matches the server pair.
+// Empty server names in a rule match any server.
+func handoffRule(from, to string) (HandoffRule, bool) {
+	for _, rule := range Conf().Handoffs {
+		if (rule.From == "" || rule.From == from) && (rule.To == "" || rule.To == to) {
+			return rule, true
+		}
+	}
+
+	return HandoffRule{}, false
+}
+
+// SetHandoffMeta sets a metadata field that is carried over
+// to the next server if the matching handoff rule selects `meta`.
+// An empty value deletes the field.
+func (cc *ClientConn) SetHandoffMeta(key, value string) {
+	cc.handoffMu.Lock()
+	defer cc.handoffMu.Unlock()
+
+	if cc.handoffMeta == nil {
+		cc.handoffMeta = make(map[string]string)
+	}
+
+	if value == "" {
+		delete(cc.handoffMeta, key)
+	} else {
+		cc.handoffMeta[key] = value
+	}
+}
+
+// prepareHandoff collects the state of the ServerConn the ClientConn
+// is about to leave according to the handoff rule for the hop.
+// The record is either kept until the control channel of the new server
+// is joined or written to the authentication backend.
+func (cc *ClientConn) prepareHandoff(sc *ServerConn, to string) {
+	rule, ok := handoffRule(sc.name, to)
+	if !ok {
+		return
+	}
+
+	ho := &Handoff{
+		Type: "handoff",
+		From: sc.name,
+		To:   to,
+	}
+
+	for _, state := range rule.State {
+		switch state {
+		case "inv":
+			ho.Inv = make(map[string][]string)
+			names := sc.clientNames()
+
+			sc.mu.RLock()
+			inv := sc.handoffInv
+			sc.mu.RUnlock()
+
+			for _, l := range inv {
+				if l.Name == "hand" {
+					continue
+				}
+
+				var stacks []string
+				for _, stk := range l.Stacks {
+					stk.Name = names.srvName(sc.mediaPool, stk.Name)
+					stacks = append(stacks, stk.String())
+				}
+
+				ho.Inv[l.Name] = stacks
+			}
+		case "hp":
+			sc.mu.RLock()
+			ho.HP = sc.hp
+			sc.mu.RUnlock()
+		case "breath":
+			sc.mu.RLock()
+			ho.Breath = sc.breath
+			sc.mu.RUnlock()
+		case "meta":
+			cc.handoffMu.RLock()
+			ho.Meta = copyMap(cc.handoffMeta)
+			cc.handoffMu.RUnlock()
+		default:
+			cc.Log("<->", "unknown handoff state", state)
+		}
+	}
+
+	if rule.Storage {
+		b, err := json.Marshal(ho)
+		if err != nil {
+			cc.Log("<->", "handoff:", err)
+			return
+		}
+
+		if err := NewStorage(HandoffNamespace).Player(cc.Name()).Set("record", string(b)); err != nil {
+			cc.Log("<->", "handoff:", err)
+		}
+
+		return
+	}
+
+	cc.handoffMu.Lock()
+	defer cc.handoffMu.Unlock()
+
+	cc.handoff = ho
+}
+
+// dropHandoff discards the pending handoff record
+// so that it isn't delivered after a failed hop.
+func (cc *ClientConn) dropHandoff() {
+	cc.handoffMu.Lock()
+	defer cc.handoffMu.Unlock()
+
+	cc.handoff = nil
+}
+
+// copyInv returns a copy of an inventory
+// that doesn't share any lists with it.
+func copyInv(inv mt.Inv) mt.Inv {
+	cp := make(mt.Inv, len(inv))
+	for i, l := range inv {
+		cp[i] = l
+		cp[i].Stacks = append([]mt.Stack{}, l.Stacks...)
+	}
+
+	return cp
+}
+
+// deliverHandoff sends the pending handoff record
+// on the control channel if the ServerConn is its destination.
+func (sc *ServerConn) deliverHandoff() {
+	clt := sc.client()
+	if clt == nil {
+		return
+	}
+
+	clt.handoffMu.Lock()
+	ho := clt.handoff
+	if ho == nil || ho.To != sc.name {
+		clt.handoffMu.Unlock()
+		return
+	}
+	clt.handoff = nil
+	clt.handoffMu.Unlock()
+
+	if err := sc.sendCtlMsg(ho); err != nil {
+		sc.Log("->", "handoff:", err)
+	}
+}
+
+func init() {
+	RegisterCtlHandler("handoff_meta", func(cc *ClientConn, msg json.RawMessage) (interface{}, error) {
+		var req struct {
+			Meta map[string]string `json:"meta"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+
+		for k, v := range req.Meta {
+			cc.SetHandoffMeta(k, v)
+		}
+
+		return nil, nil
+	})
+}
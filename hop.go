@@ -4,6 +4,7 @@ import (
 	"errors"
 	"image/color"
 	"net"
+	"slices"
 
 	"github.com/HimbeerserverDE/mt"
 )
@@ -16,6 +17,7 @@ var (
 
 // Hop connects the ClientConn to the specified upstream server
 // or the first working fallback server, saving the player's last server
+// and the last server within each of its groups
 // unless `ForceDefaultSrv` is enabled.
 // If all attempts fail the client stays connected to the current server
 // with the potential for inconsistent state.
@@ -25,6 +27,9 @@ func (cc *ClientConn) Hop(serverName string) (err error) {
 	defer func() {
 		if err == nil && !Conf().ForceDefaultSrv {
 			err = authIface.SetLastSrv(cc.Name(), serverName)
+			if err == nil {
+				err = cc.saveLastGroupSrvs()
+			}
 		}
 	}()
 
@@ -54,6 +59,8 @@ func (cc *ClientConn) Hop(serverName string) (err error) {
 // HopGroup connects the ClientConn to the specified server group
 // or the first working fallback server, saving the player's last server
 // unless `ForceDefaultSrv` is enabled.
+// If the player has been on a member of the group before
+// and that server is still in the group, they are returned to it.
 // See the documentation on `Server.Groups` in `doc/config.md`
 // for details on how a specific game server is selected from the group name.
 // If all attempts fail the client stays connected to the current server
@@ -61,6 +68,10 @@ func (cc *ClientConn) Hop(serverName string) (err error) {
 // At the moment the ClientConn is NOT fixed if an error occurs
 // so the player may have to reconnect.
 func (cc *ClientConn) HopGroup(groupName string) error {
+	if choice, ok := cc.lastGroupSrv(groupName); ok {
+		return cc.Hop(choice)
+	}
+
 	choice, ok := Conf().RandomGroupServer(groupName)
 	if !ok {
 		return ErrNoSuchServer
@@ -69,6 +80,41 @@ func (cc *ClientConn) HopGroup(groupName string) error {
 	return cc.Hop(choice)
 }
 
+// lastGroupSrv returns the last server the ClientConn was on
+// within the specified server group if it is still a member of the group.
+// It always fails if `ForceDefaultSrv` is enabled.
+func (cc *ClientConn) lastGroupSrv(groupName string) (string, bool) {
+	conf := Conf()
+	if conf.ForceDefaultSrv {
+		return "", false
+	}
+
+	srvName, err := authIface.LastGroupSrv(cc.Name(), groupName)
+	if err != nil {
+		return "", false
+	}
+
+	srv, ok := conf.Servers[srvName]
+	if !ok {
+		return "", false
+	}
+
+	return srvName, slices.Contains(srv.Groups, groupName)
+}
+
+// saveLastGroupSrvs remembers the current server of the ClientConn
+// as its last server within each group the server is in.
+func (cc *ClientConn) saveLastGroupSrvs() error {
+	srvName := cc.ServerName()
+	for _, grp := range Conf().Servers[srvName].Groups {
+		if err := authIface.SetLastGroupSrv(cc.Name(), grp, srvName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // HopRaw connects the ClientConn to the specified upstream server.
 // At the moment the ClientConn is NOT fixed if an error occurs
 // so the player may have to reconnect.
@@ -76,7 +122,23 @@ func (cc *ClientConn) HopGroup(groupName string) error {
 // This method ignores fallback servers and doesn't save the player's
 // last server.
 // You may use the `Hop` wrapper for these purposes.
-func (cc *ClientConn) HopRaw(serverName string) error {
+// Hop handlers registered using RegisterOnHopStart, RegisterOnHopDone
+// and RegisterOnHopFail are called by this method.
+// State is carried over to the new server according to
+// the `Handoffs` config option.
+func (cc *ClientConn) HopRaw(serverName string) (err error) {
+	from := cc.ServerName()
+	handleHopStart(cc, from, serverName)
+
+	defer func() {
+		if err != nil {
+			cc.dropHandoff()
+			handleHopFail(cc, from, serverName, err)
+		} else {
+			handleHopDone(cc, from, serverName)
+		}
+	}()
+
 	cc.hopMu.Lock()
 	defer cc.hopMu.Unlock()
 
@@ -99,6 +161,8 @@ func (cc *ClientConn) HopRaw(serverName string) error {
 		return ErrNewMediaPool
 	}
 
+	cc.prepareHandoff(cc.server(), serverName)
+
 	// This needs to be done before the ServerConn is closed
 	// so the clientConn isn't closed by the packet handler
 	cc.server().mu.Lock()
@@ -106,6 +170,7 @@ func (cc *ClientConn) HopRaw(serverName string) error {
 	cc.server().mu.Unlock()
 
 	cc.server().Close()
+	cc.forgetDynMedia(from)
 
 	// Player CAO is a good indicator for full client initialization.
 	if cc.hasPlayerCAO() {
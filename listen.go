@@ -77,6 +77,9 @@ func (l *listener) accept() (*ClientConn, error) {
 		logger:  log.New(logWriter, prefix, log.LstdFlags|log.Lmsgprefix),
 		initCh:  make(chan struct{}),
 		modChs:  make(map[string]struct{}),
+
+		dynMedia:       make(map[string]*dynMediaFile),
+		dynMediaTokens: make(map[uint32]dynMediaToken),
 	}
 
 	l.mu.Lock()
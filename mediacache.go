@@ -1,19 +1,284 @@
 package proxy
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"log"
 	"os"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-func (cc *contentConn) fromCache(filename, base64SHA1 string) bool {
+const (
+	cacheIndexFile          = "index.json"
+	cacheIndexFlushInterval = time.Minute
+)
+
+// A CacheEntry describes a file in the media cache.
+type CacheEntry struct {
+	// Hash is the base64 encoded SHA1 hash of the file.
+	Hash     string
+	Size     int64
+	LastUsed time.Time
+	// Pools are the media pools that use the file
+	// during the initial media transfer.
+	Pools []string
+	// Dynamic is true if the file has been pushed
+	// by a server at runtime.
+	Dynamic bool
+	// DynamicUsed is the last time the file has been pushed.
+	DynamicUsed time.Time
+}
+
+var (
+	cacheIndex      map[string]*CacheEntry
+	cacheIndexDirty bool
+	cacheIndexMu    sync.Mutex
+)
+
+// loadCacheIndex reads the cache index if it hasn't been loaded yet
+// and makes it match the files that actually exist.
+// The caller must hold cacheIndexMu.
+func loadCacheIndex() error {
+	if cacheIndex != nil {
+		return nil
+	}
+
 	os.Mkdir(Path("cache"), 0777)
 
-	// convert to filename safe b64
-	base64SHA1Filesafe := strings.Replace(base64SHA1, "/", "_", -1)
-	base64SHA1Filesafe = strings.Replace(base64SHA1Filesafe, "+", "-", -1)
+	index := make(map[string]*CacheEntry)
 
-	data, err := os.ReadFile(Path("cache/", base64SHA1Filesafe))
+	data, err := os.ReadFile(Path("cache/", cacheIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(data) > 0 {
+		var entries []*CacheEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			// The index is rebuilt from the files.
+			log.Print("media cache index: ", err)
+			entries = nil
+			cacheIndexDirty = true
+		}
+
+		for _, e := range entries {
+			index[e.Hash] = e
+		}
+	}
+
+	dir, err := os.ReadDir(Path("cache"))
+	if err != nil {
+		return err
+	}
+
+	onDisk := make(map[string]struct{})
+	for _, f := range dir {
+		if f.Name() == cacheIndexFile || f.IsDir() {
+			continue
+		}
+
+		hash := cacheNameToBase64(f.Name())
+		onDisk[hash] = struct{}{}
+
+		if _, ok := index[hash]; ok {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+
+		index[hash] = &CacheEntry{
+			Hash:     hash,
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		}
+	}
+
+	for hash := range index {
+		if _, ok := onDisk[hash]; !ok {
+			delete(index, hash)
+		}
+	}
+
+	cacheIndex = index
+	return nil
+}
+
+// saveCacheIndex writes the cache index to disk.
+// The caller must hold cacheIndexMu.
+func saveCacheIndex() error {
+	if cacheIndex == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(sortedCacheEntries(), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(Path("cache/", cacheIndexFile), data, 0666); err != nil {
+		return err
+	}
+
+	cacheIndexDirty = false
+	return nil
+}
+
+// flushCacheIndex periodically writes the cache index to disk
+// if it has changed so that frequent changes like dynamic media
+// don't have to write it every time. Expired dynamic media
+// is removed at the same time.
+func flushCacheIndex() {
+	for range time.Tick(cacheIndexFlushInterval) {
+		cacheIndexMu.Lock()
+		if cacheIndex != nil {
+			expireDynamicCache()
+		}
+
+		if cacheIndexDirty {
+			if err := saveCacheIndex(); err != nil {
+				log.Print("media cache index: ", err)
+			}
+		}
+		cacheIndexMu.Unlock()
+	}
+}
+
+// dynamicExpired reports whether a file is only used as dynamic media
+// and hasn't been pushed for retention days.
+// Files that have never been pushed count as expired.
+// A retention of 0 or less keeps dynamic media forever.
+func dynamicExpired(e *CacheEntry, retention int) bool {
+	if !e.Dynamic {
+		return true
+	}
+
+	if retention <= 0 {
+		return false
+	}
+
+	return time.Since(e.DynamicUsed) > time.Duration(retention)*24*time.Hour
+}
+
+// expireDynamicCache removes dynamic media that isn't owned by
+// any media pool once its retention period is over.
+// The caller must hold cacheIndexMu.
+func expireDynamicCache() {
+	retention := Conf().MediaCache.DynamicRetention
+
+	var removed int
+	var freed int64
+	for hash, e := range cacheIndex {
+		if !e.Dynamic || len(e.Pools) > 0 || !dynamicExpired(e, retention) {
+			continue
+		}
+
+		if err := rmCacheEntry(hash); err != nil {
+			continue
+		}
+
+		removed++
+		freed += e.Size
+	}
+
+	if removed > 0 {
+		log.Printf("media cache: expired %d dynamic files (%d bytes)", removed, freed)
+	}
+}
+
+// sortedCacheEntries returns copies of all index entries sorted by hash.
+// The caller must hold cacheIndexMu.
+func sortedCacheEntries() []CacheEntry {
+	entries := make([]CacheEntry, 0, len(cacheIndex))
+	for _, e := range cacheIndex {
+		entry := *e
+		entry.Pools = slices.Clone(e.Pools)
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Hash < entries[j].Hash
+	})
+
+	return entries
+}
+
+// touchCache records a use of a cached file by a media pool.
+// The pool may be empty. Dynamic media doesn't make
+// the pool an owner of the file.
+// The caller must hold cacheIndexMu.
+func touchCache(hash, pool string, size int64, dynamic bool) {
+	e, ok := cacheIndex[hash]
+	if !ok {
+		e = &CacheEntry{Hash: hash}
+		cacheIndex[hash] = e
+	}
+
+	e.Size = size
+	e.LastUsed = time.Now()
+	cacheIndexDirty = true
+
+	if dynamic {
+		e.Dynamic = true
+		e.DynamicUsed = e.LastUsed
+		return
+	}
+
+	if pool != "" && !slices.Contains(e.Pools, pool) {
+		e.Pools = append(e.Pools, pool)
+		sort.Strings(e.Pools)
+	}
+}
+
+// useCache records that a cached file has been used
+// without changing its owners.
+func useCache(hash string, dynamic bool) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return
+	}
+
+	if e, ok := cacheIndex[hash]; ok {
+		e.LastUsed = time.Now()
+		if dynamic {
+			e.Dynamic = true
+			e.DynamicUsed = e.LastUsed
+		}
+
+		cacheIndexDirty = true
+	}
+}
+
+// setPoolMedia makes the specified files the only
+// files owned by a media pool.
+// The caller must hold cacheIndexMu.
+func setPoolMedia(pool string, hashes map[string]struct{}) {
+	for hash, e := range cacheIndex {
+		if _, ok := hashes[hash]; ok {
+			continue
+		}
+
+		e.Pools = slices.DeleteFunc(e.Pools, func(p string) bool {
+			return p == pool
+		})
+	}
+}
+
+func (cc *contentConn) fromCache(filename, base64SHA1 string) bool {
+	os.Mkdir(Path("cache"), 0777)
+
+	data, err := os.ReadFile(cachePath(base64SHA1))
 	if err != nil {
 		if !os.IsNotExist(err) {
 			cc.log("->", "cache", err)
@@ -34,20 +299,272 @@ func (cc *contentConn) fromCache(filename, base64SHA1 string) bool {
 func (cc *contentConn) updateCache() {
 	os.Mkdir(Path("cache"), 0777)
 
+	// The files are written even if the index is broken
+	// so that the media server can serve them.
 	for _, f := range cc.media {
-		// convert to filename safe b64
-		base64SHA1Filesafe := strings.Replace(f.base64SHA1, "/", "_", -1)
-		base64SHA1Filesafe = strings.Replace(base64SHA1Filesafe, "+", "-", -1)
+		if _, err := os.Stat(cachePath(f.base64SHA1)); os.IsNotExist(err) {
+			if err := os.WriteFile(cachePath(f.base64SHA1), f.data, 0666); err != nil {
+				cc.log("->", "cache", err)
+			}
+		}
+	}
 
-		os.WriteFile(Path("cache/", base64SHA1Filesafe), f.data, 0666)
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		cc.log("->", "cache index", err)
+		return
+	}
+
+	hashes := make(map[string]struct{})
+	for _, f := range cc.media {
+		touchCache(f.base64SHA1, cc.mediaPool, int64(len(f.data)), false)
+		hashes[f.base64SHA1] = struct{}{}
+	}
+
+	setPoolMedia(cc.mediaPool, hashes)
+	limitCache()
+
+	if err := saveCacheIndex(); err != nil {
+		cc.log("->", "cache index", err)
 	}
 }
 
-func cacheMedia(data []byte) error {
+func cacheMedia(pool string, data []byte, dynamic bool) error {
+	os.Mkdir(Path("cache"), 0777)
+
 	hash := sha1.Sum(data)
 	sum := b64.EncodeToString(hash[:])
-	safeSum := strings.Replace(sum, "/", "_", -1)
-	safeSum = strings.Replace(safeSum, "+", "-", -1)
 
-	return os.WriteFile(Path("cache/", safeSum), data, 0666)
+	if err := os.WriteFile(cachePath(sum), data, 0666); err != nil {
+		return err
+	}
+
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return err
+	}
+
+	// The index is written by flushCacheIndex.
+	touchCache(sum, pool, int64(len(data)), dynamic)
+	limitCache()
+
+	return nil
+}
+
+// readCache returns the content of a cached file.
+// Dynamic media is kept for `MediaCache.DynamicRetention` days
+// after it has last been read.
+func readCache(base64SHA1 string, dynamic bool) ([]byte, error) {
+	data, err := os.ReadFile(cachePath(base64SHA1))
+	if err != nil {
+		return nil, err
+	}
+
+	useCache(base64SHA1, dynamic)
+	return data, nil
+}
+
+// limitCache evicts files if the cache is larger than
+// the `MediaCache.MaxSize` config option allows.
+// The caller must hold cacheIndexMu.
+func limitCache() {
+	maxSize := Conf().MediaCache.MaxSize
+	if maxSize <= 0 {
+		return
+	}
+
+	n, freed := evictCache(maxSize)
+	if n > 0 {
+		log.Printf("media cache: evicted %d files (%d bytes)", n, freed)
+	}
+}
+
+// evictCache removes the least recently used files
+// until the cache is no larger than maxSize.
+// The caller must hold cacheIndexMu.
+func evictCache(maxSize int64) (removed int, freed int64) {
+	var size int64
+	entries := make([]*CacheEntry, 0, len(cacheIndex))
+	for _, e := range cacheIndex {
+		size += e.Size
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	for _, e := range entries {
+		if size <= maxSize {
+			break
+		}
+
+		if err := rmCacheEntry(e.Hash); err != nil {
+			continue
+		}
+
+		size -= e.Size
+		freed += e.Size
+		removed++
+	}
+
+	return
+}
+
+// rmCacheEntry deletes a cached file and its index entry.
+// The caller must hold cacheIndexMu.
+func rmCacheEntry(hash string) error {
+	err := os.Remove(cachePath(hash))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	delete(cacheIndex, hash)
+	cacheIndexDirty = true
+	return nil
+}
+
+// CacheEntries returns all files in the media cache
+// sorted by their hashes.
+func CacheEntries() ([]CacheEntry, error) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return nil, err
+	}
+
+	return sortedCacheEntries(), nil
+}
+
+// PruneCache removes the least recently used files from the media cache
+// until its total size doesn't exceed maxSize bytes.
+// It returns the number of files removed and the number of bytes freed.
+func PruneCache(maxSize int64) (removed int, freed int64, err error) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return 0, 0, err
+	}
+
+	removed, freed = evictCache(maxSize)
+	return removed, freed, saveCacheIndex()
+}
+
+// GCCache removes all files from the media cache that aren't used
+// by any media pool that is currently configured
+// and haven't been pushed as dynamic media recently.
+// Ownership is updated whenever the content of a pool is fetched.
+// It returns the number of files removed and the number of bytes freed.
+func GCCache() (removed int, freed int64, err error) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return 0, 0, err
+	}
+
+	conf := Conf()
+	pools := conf.Pools()
+	for hash, e := range cacheIndex {
+		used := slices.ContainsFunc(e.Pools, func(pool string) bool {
+			_, ok := pools[pool]
+			return ok
+		})
+
+		if used || !dynamicExpired(e, conf.MediaCache.DynamicRetention) {
+			continue
+		}
+
+		if err := rmCacheEntry(hash); err != nil {
+			return removed, freed, err
+		}
+
+		removed++
+		freed += e.Size
+	}
+
+	return removed, freed, saveCacheIndex()
+}
+
+// VerifyCache hashes all files in the media cache and returns
+// the hashes of the ones whose content doesn't match their name.
+// If fix is true these files are removed.
+func VerifyCache(fix bool) ([]string, error) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	if err := loadCacheIndex(); err != nil {
+		return nil, err
+	}
+
+	var corrupt []string
+	for hash := range cacheIndex {
+		want, err := b64.DecodeString(hash)
+		if err != nil {
+			corrupt = append(corrupt, hash)
+			continue
+		}
+
+		data, err := os.ReadFile(cachePath(hash))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				corrupt = append(corrupt, hash)
+				continue
+			}
+
+			return nil, err
+		}
+
+		sum := sha1.Sum(data)
+		if !bytes.Equal(sum[:], want) {
+			corrupt = append(corrupt, hash)
+		}
+	}
+
+	sort.Strings(corrupt)
+
+	if fix {
+		for _, hash := range corrupt {
+			if err := rmCacheEntry(hash); err != nil {
+				return corrupt, err
+			}
+		}
+
+		if err := saveCacheIndex(); err != nil {
+			return corrupt, err
+		}
+	}
+
+	return corrupt, nil
+}
+
+// SaveCacheIndex writes pending changes to the media cache index to disk.
+func SaveCacheIndex() error {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+
+	return saveCacheIndex()
+}
+
+// cachePath returns the path of the cache file
+// holding the media file with the specified hash.
+func cachePath(base64SHA1 string) string {
+	// convert to filename safe b64
+	base64SHA1Filesafe := strings.Replace(base64SHA1, "/", "_", -1)
+	base64SHA1Filesafe = strings.Replace(base64SHA1Filesafe, "+", "-", -1)
+
+	return Path("cache/", base64SHA1Filesafe)
+}
+
+// cacheNameToBase64 converts the name of a cache file
+// back to the base64 encoded hash of its content.
+func cacheNameToBase64(name string) string {
+	base64SHA1 := strings.Replace(name, "_", "/", -1)
+	return strings.Replace(base64SHA1, "-", "+", -1)
 }
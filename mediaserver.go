@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// The magic and version of the remote media index format
+// used by Minetest.
+const (
+	mediaIndexMagic   = "MTHS"
+	mediaIndexVersion = 1
+)
+
+// maxMediaIndexSize limits the size of index.mth requests.
+const maxMediaIndexSize = 16 << 20
+
+var (
+	ErrInvalidMediaIndex = errors.New("invalid media index")
+)
+
+// mediaServerURL returns the URL of the remote media server
+// as announced to clients or an empty string if it is disabled.
+func mediaServerURL() string {
+	conf := Conf()
+	if !conf.MediaServer.Enable || conf.MediaServer.URL == "" {
+		return ""
+	}
+
+	url := conf.MediaServer.URL
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+
+	return url
+}
+
+// serveMedia runs the remote media server.
+// It serves the files in the media cache using
+// the Minetest remote media protocol.
+func serveMedia() {
+	conf := Conf()
+	if conf.MediaServer.URL == "" {
+		log.Print("media server URL not set, clients won't use it")
+	}
+
+	log.Print("media server listen ", conf.MediaServer.Addr)
+
+	err := http.ListenAndServe(conf.MediaServer.Addr, http.HandlerFunc(handleMediaReq))
+	log.Print("media server: ", err)
+}
+
+func handleMediaReq(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	if name == "index.mth" {
+		handleMediaIndex(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sum, err := hex.DecodeString(name)
+	if err != nil || len(sum) != 20 {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(cachePath(b64.EncodeToString(sum)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	useCache(b64.EncodeToString(sum), false)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, startTime, f)
+}
+
+// handleMediaIndex responds with the hashes of the requested files
+// that are available. If no hashes are requested
+// all available files are listed.
+func handleMediaIndex(w http.ResponseWriter, r *http.Request) {
+	var want [][]byte
+
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxMediaIndexSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		want, err = parseMediaIndex(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		dir, err := os.ReadDir(Path("cache"))
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, f := range dir {
+			sum, err := b64.DecodeString(cacheNameToBase64(f.Name()))
+			if err != nil || len(sum) != 20 {
+				continue
+			}
+
+			want = append(want, sum)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(mediaIndexMagic)
+	binary.Write(buf, binary.BigEndian, uint16(mediaIndexVersion))
+
+	for _, sum := range want {
+		if _, err := os.Stat(cachePath(b64.EncodeToString(sum))); err == nil {
+			buf.Write(sum)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(buf.Bytes())
+}
+
+func parseMediaIndex(data []byte) ([][]byte, error) {
+	if len(data) < 6 || string(data[:4]) != mediaIndexMagic {
+		return nil, ErrInvalidMediaIndex
+	}
+
+	if binary.BigEndian.Uint16(data[4:6]) != mediaIndexVersion {
+		return nil, ErrInvalidMediaIndex
+	}
+
+	data = data[6:]
+	if len(data)%20 != 0 {
+		return nil, ErrInvalidMediaIndex
+	}
+
+	var sums [][]byte
+	for len(data) > 0 {
+		sums = append(sums, data[:20])
+		data = data[20:]
+	}
+
+	return sums, nil
+}
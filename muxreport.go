@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// A MuxReport describes what the proxy did
+// when it multiplexed the content of the media pools.
+type MuxReport struct {
+	Time time.Time
+
+	// Pools maps the names of the media pools that were fetched
+	// to the amount of content they provided.
+	Pools map[string]PoolReport
+	// FailedPools are the media pools whose content
+	// couldn't be fetched. Players can't join their servers.
+	FailedPools []string
+
+	// Param0 maps server names to their translation tables
+	// from server content IDs to client content IDs.
+	Param0 map[string]map[mt.Content]mt.Content
+	// Param0Srv maps client content IDs to the server
+	// and server content ID they originate from.
+	Param0Srv map[mt.Content]Param0Origin
+
+	// Collisions are prefixed names that are defined
+	// by more than one media pool.
+	Collisions []NameCollision
+	// MissingMedia are texture references in definitions
+	// that point to files their media pool doesn't have.
+	MissingMedia []MissingMedia
+	// MediaAliases maps the names of deduplicated media files
+	// to the names of the files that replace them.
+	MediaAliases map[string]string
+	// SharedConflicts are the definitions of shared mods
+	// that differ between media pools.
+	SharedConflicts []SharedDefConflict
+}
+
+// A PoolReport contains the amount of content a media pool provided.
+type PoolReport struct {
+	Server string
+	Items  int
+	Nodes  int
+	Media  int
+}
+
+// A Param0Origin is the server a client content ID
+// originates from.
+type Param0Origin struct {
+	Server string
+	Param0 mt.Content
+}
+
+// A NameCollision is a name that multiple media pools
+// define after prefixing.
+type NameCollision struct {
+	Kind  string // "item", "node" or "media"
+	Name  string
+	Pools []string
+}
+
+// A MissingMedia is a texture reference to a file
+// the media pool of the definition doesn't have.
+type MissingMedia struct {
+	Pool string
+	Def  string
+	File string
+}
+
+var (
+	ErrNoMuxReport = errors.New("content hasn't been fetched yet")
+)
+
+var (
+	lastMuxReport   *MuxReport
+	lastMuxReportMu sync.RWMutex
+)
+
+// LastMuxReport returns a report on the last time
+// the content of the media pools was fetched
+// or nil if it hasn't been fetched yet.
+// The report must not be modified.
+func LastMuxReport() *MuxReport {
+	lastMuxReportMu.RLock()
+	defer lastMuxReportMu.RUnlock()
+
+	return lastMuxReport
+}
+
+func muxReport(conns []*contentConn, mux *muxResult) {
+	report := &MuxReport{
+		Time:            time.Now(),
+		Pools:           make(map[string]PoolReport),
+		Param0:          mux.p0Map,
+		Param0Srv:       make(map[mt.Content]Param0Origin),
+		MediaAliases:    mux.names.mediaAliases,
+		SharedConflicts: SharedDefConflicts(),
+	}
+
+	for pool := range mux.denyPools {
+		report.FailedPools = append(report.FailedPools, pool)
+	}
+	sort.Strings(report.FailedPools)
+
+	for p0, srv := range mux.p0SrvMap {
+		report.Param0Srv[p0] = Param0Origin{
+			Server: srv.name,
+			Param0: srv.param0,
+		}
+	}
+
+	defined := map[string]map[string][]string{
+		"item":  make(map[string][]string),
+		"node":  make(map[string][]string),
+		"media": make(map[string][]string),
+	}
+
+	// Shared definitions are supposed to be defined
+	// by multiple pools.
+	define := func(kind, pool, name string) {
+		if isDefaultNode(name) || mux.names.isShared(pool, name) {
+			return
+		}
+
+		if kind != "media" {
+			prepend(mux.names.prefixer(pool), &name)
+		} else {
+			// Media names must not be deduplicated here.
+			name = mux.names.prefixNameRaw(pool, name)
+		}
+
+		if !slices.Contains(defined[kind][name], pool) {
+			defined[kind][name] = append(defined[kind][name], pool)
+		}
+	}
+
+	for _, cc := range conns {
+		<-cc.done()
+		if !cc.success {
+			continue
+		}
+
+		report.Pools[cc.mediaPool] = PoolReport{
+			Server: cc.name,
+			Items:  len(cc.itemDefs),
+			Nodes:  len(cc.nodeDefs),
+			Media:  len(cc.media),
+		}
+
+		media := make(map[string]struct{})
+		for _, f := range cc.media {
+			media[f.name] = struct{}{}
+			define("media", cc.mediaPool, f.name)
+		}
+
+		missing := func(def string, textures ...mt.Texture) {
+			for _, t := range textures {
+				for _, file := range textureFiles(string(t)) {
+					if _, ok := media[file]; !ok {
+						report.MissingMedia = append(report.MissingMedia, MissingMedia{
+							Pool: cc.mediaPool,
+							Def:  def,
+							File: file,
+						})
+					}
+				}
+			}
+		}
+
+		for _, def := range cc.itemDefs {
+			if def.Name == "" {
+				def.Name = "hand"
+			}
+
+			define("item", cc.mediaPool, def.Name)
+			missing(def.Name, def.InvImg, def.WieldImg, def.Palette, def.InvOverlay, def.WieldOverlay)
+		}
+
+		for _, def := range cc.nodeDefs {
+			define("node", cc.mediaPool, def.Name)
+
+			textures := []mt.Texture{def.Palette}
+			for _, tiles := range [][6]mt.TileDef{def.Tiles, def.OverlayTiles, def.SpecialTiles} {
+				for _, tile := range tiles {
+					textures = append(textures, tile.Texture)
+				}
+			}
+
+			missing(def.Name, textures...)
+		}
+	}
+
+	for _, kind := range []string{"item", "node", "media"} {
+		for name, pools := range defined[kind] {
+			if len(pools) < 2 {
+				continue
+			}
+
+			sort.Strings(pools)
+			report.Collisions = append(report.Collisions, NameCollision{
+				Kind:  kind,
+				Name:  name,
+				Pools: pools,
+			})
+		}
+	}
+
+	sort.Slice(report.Collisions, func(i, j int) bool {
+		if report.Collisions[i].Kind != report.Collisions[j].Kind {
+			return report.Collisions[i].Kind < report.Collisions[j].Kind
+		}
+
+		return report.Collisions[i].Name < report.Collisions[j].Name
+	})
+
+	lastMuxReportMu.Lock()
+	defer lastMuxReportMu.Unlock()
+
+	lastMuxReport = report
+}
+
+// WriteMuxReport writes the last MuxReport to a JSON file
+// in the proxy directory and returns its path.
+func WriteMuxReport() (string, error) {
+	report := LastMuxReport()
+	if report == nil {
+		return "", ErrNoMuxReport
+	}
+
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return "", err
+	}
+
+	path := Path("mux_report.json")
+	return path, os.WriteFile(path, data, 0666)
+}
@@ -1,54 +1,320 @@
 package proxy
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
-// Perms returns the raw permissions of the ClientConn.
-func (cc *ClientConn) Perms() []string {
-	if cc.Name() == "" {
+// A playerGrants holds the group assignments and permission grants
+// the authentication backend stores for a player.
+type playerGrants struct {
+	groups []UserGroup
+	perms  []UserPerm
+}
+
+// grantsOf returns the grants stored for a player.
+// They are cached by the ClientConn of the player if it is non-nil
+// so that permission checks don't have to access the backend.
+func grantsOf(name string, cc *ClientConn) playerGrants {
+	if authIface == nil {
+		return playerGrants{}
+	}
+
+	cacheable := cc != nil && name != "" && cc.Name() == name
+	if cacheable {
+		cc.grantsMu.Lock()
+		defer cc.grantsMu.Unlock()
+
+		if cc.grants != nil {
+			return *cc.grants
+		}
+	}
+
+	groups, err := authIface.UserGroups(name)
+	if err != nil {
+		return playerGrants{}
+	}
+
+	perms, err := authIface.UserPerms(name)
+	if err != nil {
+		return playerGrants{groups: groups}
+	}
+
+	grants := playerGrants{groups: groups, perms: perms}
+	if cacheable {
+		cc.grants = &grants
+
+		// Upstream privileges depend on the groups,
+		// so they have to be synced once an assignment expires.
+		for _, g := range groups {
+			if !g.Expiry.IsZero() && !expired(g.Expiry) {
+				time.AfterFunc(time.Until(g.Expiry), func() {
+					uncacheGrants(name)
+					syncPlayerPrivs(name)
+				})
+			}
+		}
+	}
+
+	return grants
+}
+
+// uncacheGrants discards the cached grants of a player
+// after they have been modified.
+func uncacheGrants(name string) {
+	if cc := Find(name); cc != nil {
+		cc.grantsMu.Lock()
+		defer cc.grantsMu.Unlock()
+
+		cc.grants = nil
+	}
+}
+
+// PlayerGroups returns the permission groups a player is a member of.
+// This includes unexpired assignments stored by the authentication
+// backend and the group from the UserGroups config option.
+// Players who aren't a member of any group are in the `default` group.
+func PlayerGroups(name string) []string {
+	return playerGroups(Conf(), name, Find(name))
+}
+
+func playerGroups(conf Config, name string, cc *ClientConn) []string {
+	var groups []string
+	if grp, ok := conf.UserGroups[name]; ok {
+		groups = append(groups, grp)
+	}
+
+	for _, g := range grantsOf(name, cc).groups {
+		if !expired(g.Expiry) {
+			groups = append(groups, g.Group)
+		}
+	}
+
+	if len(groups) == 0 {
+		return []string{"default"}
+	}
+
+	return groups
+}
+
+// playerGroupsInherited returns the permission groups of a player
+// and all groups they inherit from.
+func playerGroupsInherited(conf Config, name string) []string {
+	var groups []string
+	visited := make(map[string]struct{})
+
+	var walk func(group string)
+	walk = func(group string) {
+		if _, ok := visited[group]; ok {
+			return
+		}
+		visited[group] = struct{}{}
+
+		groups = append(groups, group)
+		for _, parent := range conf.GroupInherit[group] {
+			walk(parent)
+		}
+	}
+
+	for _, grp := range playerGroups(conf, name, Find(name)) {
+		walk(grp)
+	}
+
+	return groups
+}
+
+// GroupPerms returns the raw permissions of a permission group
+// including the ones inherited from its parent groups.
+// Inherited permissions come first.
+func GroupPerms(group string) []string {
+	return groupPerms(Conf(), group)
+}
+
+func groupPerms(conf Config, group string) []string {
+	var perms []string
+	visited := make(map[string]struct{})
+
+	var walk func(group string)
+	walk = func(group string) {
+		if _, ok := visited[group]; ok {
+			return
+		}
+		visited[group] = struct{}{}
+
+		for _, parent := range conf.GroupInherit[group] {
+			walk(parent)
+		}
+
+		perms = append(perms, conf.Groups[group]...)
+	}
+
+	walk(group)
+	return perms
+}
+
+// PlayerPerms returns the raw permissions of a player.
+// This includes the permissions of all of their groups
+// and unexpired permissions granted to them directly.
+func PlayerPerms(name string) []string {
+	return playerPerms(Conf(), name, Find(name))
+}
+
+func playerPerms(conf Config, name string, cc *ClientConn) []string {
+	if name == "" {
 		return []string{}
 	}
 
-	grp, ok := Conf().UserGroups[cc.Name()]
-	if !ok {
-		grp = "default"
+	perms := []string{}
+	for _, grp := range playerGroups(conf, name, cc) {
+		perms = append(perms, groupPerms(conf, grp)...)
+	}
+
+	for _, p := range grantsOf(name, cc).perms {
+		if !expired(p.Expiry) {
+			perms = append(perms, p.Perm)
+		}
+	}
+
+	return perms
+}
+
+// AddUserGroup adds a player to a permission group.
+// If d is non-zero the player is removed from the group
+// again after that duration.
+func AddUserGroup(name, group string, d time.Duration) error {
+	if err := authIface.AddUserGroup(name, group, expiryAfter(d)); err != nil {
+		return err
+	}
+
+	uncacheGrants(name)
+	syncPlayerPrivs(name)
+	return nil
+}
+
+// RmUserGroup removes a player from a permission group.
+// Groups assigned using the UserGroups config option
+// can't be removed at runtime.
+func RmUserGroup(name, group string) error {
+	if err := authIface.RmUserGroup(name, group); err != nil {
+		return err
 	}
 
-	if perms, ok := Conf().Groups[grp]; ok {
-		return perms
+	uncacheGrants(name)
+	syncPlayerPrivs(name)
+	return nil
+}
+
+// AddUserPerm grants a permission to a player directly.
+// If d is non-zero the permission is revoked again
+// after that duration.
+func AddUserPerm(name, perm string, d time.Duration) error {
+	if err := authIface.AddUserPerm(name, perm, expiryAfter(d)); err != nil {
+		return err
 	}
 
-	return []string{}
+	uncacheGrants(name)
+	return nil
+}
+
+// RmUserPerm revokes a permission granted by AddUserPerm.
+func RmUserPerm(name, perm string) error {
+	if err := authIface.RmUserPerm(name, perm); err != nil {
+		return err
+	}
+
+	uncacheGrants(name)
+	return nil
+}
+
+// Perms returns the raw permissions of the ClientConn.
+func (cc *ClientConn) Perms() []string {
+	return playerPerms(Conf(), cc.Name(), cc)
 }
 
 // HasPerms returns true if the ClientConn has all
 // of the specified permissions. Otherwise it returns false.
-// This method matches wildcards, but they may only be used
-// at the end of a raw permission. Asterisks in other places
-// will be treated as regular characters.
+// Contextual permissions are evaluated
+// using the current server of the ClientConn.
 func (cc *ClientConn) HasPerms(want ...string) bool {
-	has := map[string]struct{}{
-		"": struct{}{},
+	// The config is only copied once per check.
+	conf := Conf()
+	return permsMatch(conf, playerPerms(conf, cc.Name(), cc), cc.ServerName(), want...)
+}
+
+// PermsMatch reports whether the raw permissions grant all
+// of the wanted permissions on the specified server.
+//
+// Raw permissions may end with a wildcard. Asterisks in other places
+// are treated as regular characters. A permission followed by
+// `@name` only applies on the server or the server group
+// with that name. A permission prefixed with `-` is negated.
+// Negated permissions take precedence over all others.
+// The empty permission is always granted.
+func PermsMatch(perms []string, srv string, want ...string) bool {
+	return permsMatch(Conf(), perms, srv, want...)
+}
+
+func permsMatch(conf Config, perms []string, srv string, want ...string) bool {
+	ctx := map[string]struct{}{srv: {}}
+	if s, ok := conf.Servers[srv]; ok {
+		for _, grp := range s.Groups {
+			ctx[grp] = struct{}{}
+		}
 	}
 
-	for _, perm := range cc.Perms() {
-		if strings.HasSuffix(perm, "*") {
-			perm = perm[:len(perm)-1]
+	for _, wperm := range want {
+		if wperm == "" {
+			continue
+		}
+
+		has := false
+		for _, perm := range perms {
+			negate := strings.HasPrefix(perm, "-")
+			perm = strings.TrimPrefix(perm, "-")
 
-			for _, wperm := range want {
-				if strings.HasPrefix(wperm, perm) {
-					has[wperm] = struct{}{}
+			if i := strings.LastIndex(perm, "@"); i >= 0 {
+				if _, ok := ctx[perm[i+1:]]; !ok {
+					continue
 				}
+
+				perm = perm[:i]
+			}
+
+			if !permMatch(perm, wperm) {
+				continue
+			}
+
+			if negate {
+				return false
 			}
-		} else {
-			has[perm] = struct{}{}
+
+			has = true
 		}
-	}
 
-	for _, perm := range want {
-		if _, ok := has[perm]; !ok {
+		if !has {
 			return false
 		}
 	}
 
 	return true
 }
+
+func permMatch(perm, want string) bool {
+	if strings.HasSuffix(perm, "*") {
+		return strings.HasPrefix(want, perm[:len(perm)-1])
+	}
+
+	return perm == want
+}
+
+func expired(expiry time.Time) bool {
+	return !expiry.IsZero() && time.Now().After(expiry)
+}
+
+func expiryAfter(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(d)
+}
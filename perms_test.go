@@ -0,0 +1,61 @@
+package proxy
+
+import "testing"
+
+func TestPermsMatch(t *testing.T) {
+	conf := Config{
+		Servers: map[string]Server{
+			"lobby":    {Groups: []string{"hub"}},
+			"survival": {Groups: []string{"games"}},
+		},
+	}
+
+	tests := []struct {
+		perms []string
+		srv   string
+		want  []string
+		has   bool
+	}{
+		{nil, "lobby", nil, true},
+		{nil, "lobby", []string{""}, true},
+		{nil, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"cmd_kick"}, "lobby", []string{"cmd_kick"}, true},
+		{[]string{"cmd_kick"}, "lobby", []string{"cmd_kick", "cmd_ban"}, false},
+		{[]string{"cmd_kick"}, "lobby", []string{"cmd_kickall"}, false},
+
+		// Wildcards.
+		{[]string{"*"}, "lobby", []string{"cmd_kick", "anything"}, true},
+		{[]string{"cmd_*"}, "lobby", []string{"cmd_kick", "cmd_ban"}, true},
+		{[]string{"cmd_*"}, "lobby", []string{"whitelist"}, false},
+		{[]string{"cmd_*"}, "lobby", []string{"cmd_"}, true},
+		{[]string{"cmd*_kick"}, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"cmd*_kick"}, "lobby", []string{"cmd*_kick"}, true},
+
+		// Negation.
+		{[]string{"*", "-cmd_kick"}, "lobby", []string{"cmd_ban"}, true},
+		{[]string{"*", "-cmd_kick"}, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"-cmd_kick", "*"}, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"cmd_*", "-cmd_*"}, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"-cmd_kick"}, "lobby", []string{"cmd_kick"}, false},
+		{[]string{"-cmd_kick"}, "lobby", []string{""}, true},
+
+		// Contexts.
+		{[]string{"cmd_kick@lobby"}, "lobby", []string{"cmd_kick"}, true},
+		{[]string{"cmd_kick@lobby"}, "survival", []string{"cmd_kick"}, false},
+		{[]string{"cmd_kick@hub"}, "lobby", []string{"cmd_kick"}, true},
+		{[]string{"cmd_kick@hub"}, "survival", []string{"cmd_kick"}, false},
+		{[]string{"cmd_kick@lobby"}, "unknown", []string{"cmd_kick"}, false},
+		{[]string{"cmd_kick@lobby"}, "", []string{"cmd_kick"}, false},
+		{[]string{"cmd_*@games"}, "survival", []string{"cmd_kick"}, true},
+		{[]string{"*", "-cmd_kick@games"}, "lobby", []string{"cmd_kick"}, true},
+		{[]string{"*", "-cmd_kick@games"}, "survival", []string{"cmd_kick"}, false},
+		{[]string{"mail@example.org@lobby"}, "lobby", []string{"mail@example.org"}, true},
+		{[]string{"mail@example.org"}, "lobby", []string{"mail@example.org"}, false},
+	}
+
+	for _, tt := range tests {
+		if has := permsMatch(conf, tt.perms, tt.srv, tt.want...); has != tt.has {
+			t.Errorf("permsMatch(%q, %q, %q) = %v, want %v", tt.perms, tt.srv, tt.want, has, tt.has)
+		}
+	}
+}
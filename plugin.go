@@ -1,15 +1,53 @@
 package proxy
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"plugin"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+var (
+	ErrPluginExists   = errors.New("duplicate plugin name")
+	ErrPluginDepCycle = errors.New("plugin dependency cycle")
+	ErrNoPluginConfig = errors.New("no plugin config section")
+)
+
+// A PluginManifest describes a plugin. It is read from the `plugin.json`
+// file in the plugin source directory or from the file with the same name
+// as a plugin .so file and the .json extension. The manifest is optional.
+type PluginManifest struct {
+	Name         string
+	Version      string
+	Depends      []string
+	ProxyVersion string
+}
+
+// PluginInfo holds information on a plugin found on startup.
+// Err is non-nil if the plugin failed to load.
+type PluginInfo struct {
+	PluginManifest
+	Loaded bool
+	Err    error
+}
+
+type pluginInfo struct {
+	PluginInfo
+	src, so string
+}
+
 var pluginsOnce sync.Once
 
+var pluginInfos = make(map[string]PluginInfo)
+var pluginInfosMu sync.RWMutex
+
 func BuildPlugin() error {
 	version, err := Version()
 	if err != nil {
@@ -77,42 +115,241 @@ func openPlugins() {
 		log.Fatal(err)
 	}
 
+	var found []*pluginInfo
 	for _, pl := range dir {
-		if pl.IsDir() && !Conf().NoAutoPlugins {
+		if pl.IsDir() {
+			if Conf().NoAutoPlugins {
+				continue
+			}
+
 			plPath := path + "/" + pl.Name()
+			found = append(found, readPlugin(pl.Name(), plPath+"/plugin.json", plPath, plPath+"/"+pl.Name()+".so"))
+		} else if strings.HasSuffix(pl.Name(), ".so") {
+			base := strings.TrimSuffix(pl.Name(), ".so")
+			found = append(found, readPlugin(base, path+"/"+base+".json", "", path+"/"+pl.Name()))
+		}
+	}
 
-			wd, err := os.Getwd()
-			if err != nil {
-				log.Fatal(err)
-			}
+	order := resolvePlugins(found)
 
-			if err := os.Chdir(plPath); err != nil {
-				log.Fatal(err)
-			}
+	for _, info := range order {
+		if errors.Is(info.Err, ErrPluginExists) {
+			log.Print("plugin ", info.Name, ": ", info.Err)
+			continue
+		}
 
-			if err := BuildPlugin(); err != nil {
-				log.Fatal(err)
-			}
+		if info.Err == nil {
+			info.Err = info.open()
+		}
+		info.Loaded = info.Err == nil
 
-			if err := os.Chdir(wd); err != nil {
-				log.Fatal(err)
-			}
+		pluginInfosMu.Lock()
+		pluginInfos[info.Name] = info.PluginInfo
+		pluginInfosMu.Unlock()
+
+		if info.Err != nil {
+			log.Print("plugin ", info.Name, ": ", info.Err)
+			continue
+		}
+
+		log.Print("load plugin ", info.Name, " ", info.Version)
+	}
+
+	log.Print("load plugins")
+}
+
+func readPlugin(name, manifest, src, so string) *pluginInfo {
+	info := &pluginInfo{
+		PluginInfo: PluginInfo{
+			PluginManifest: PluginManifest{Name: name},
+		},
+		src: src,
+		so:  so,
+	}
+
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			info.Err = err
+		}
+
+		return info
+	}
+
+	if err := json.Unmarshal(data, &info.PluginManifest); err != nil {
+		info.Err = fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if info.Name == "" {
+		info.Name = name
+	}
+
+	return info
+}
+
+// resolvePlugins returns the plugins in an order that satisfies
+// their dependencies. Plugins with missing, failed or cyclic dependencies
+// or an incompatible proxy version have their error set.
+func resolvePlugins(found []*pluginInfo) []*pluginInfo {
+	byName := make(map[string]*pluginInfo)
+	for _, info := range found {
+		if _, ok := byName[info.Name]; ok {
+			info.Err = ErrPluginExists
+			continue
+		}
+
+		byName[info.Name] = info
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	version, _ := Version()
+
+	var order []*pluginInfo
+	state := make(map[string]int) // 1: visiting, 2: done
+
+	var visit func(info *pluginInfo)
+	visit = func(info *pluginInfo) {
+		switch state[info.Name] {
+		case 1:
+			info.Err = ErrPluginDepCycle
+			return
+		case 2:
+			return
+		}
+
+		state[info.Name] = 1
+
+		if info.Err == nil && info.ProxyVersion != "" && !versionAtLeast(version, info.ProxyVersion) {
+			info.Err = fmt.Errorf("requires proxy version %s, running %s", info.ProxyVersion, version)
+		}
+
+		for _, dep := range info.Depends {
+			depInfo, ok := byName[dep]
+			if !ok {
+				if info.Err == nil {
+					info.Err = fmt.Errorf("missing dependency %s", dep)
+				}
 
-			_, err = plugin.Open(path + "/" + pl.Name() + "/" + pl.Name() + ".so")
-			if err != nil {
-				log.Print(err)
 				continue
 			}
-		} else if !pl.IsDir() {
-			_, err := plugin.Open(path + "/" + pl.Name())
-			if err != nil {
-				log.Print(err)
-				continue
+
+			visit(depInfo)
+			if depInfo.Err != nil && info.Err == nil {
+				info.Err = fmt.Errorf("dependency %s failed: %w", dep, depInfo.Err)
 			}
 		}
+
+		state[info.Name] = 2
+		order = append(order, info)
 	}
 
-	log.Print("load plugins")
+	for _, name := range names {
+		visit(byName[name])
+	}
+
+	for _, info := range found {
+		if errors.Is(info.Err, ErrPluginExists) {
+			order = append(order, info)
+		}
+	}
+
+	return order
+}
+
+func (info *pluginInfo) open() (err error) {
+	if info.src != "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		if err := os.Chdir(info.src); err != nil {
+			return err
+		}
+
+		buildErr := BuildPlugin()
+
+		if err := os.Chdir(wd); err != nil {
+			log.Fatal(err)
+		}
+
+		if buildErr != nil {
+			return fmt.Errorf("build failed: %w", buildErr)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	_, err = plugin.Open(info.so)
+	return
+}
+
+// versionAtLeast reports whether the version have is at least want.
+// Both are expected to be in the vMAJOR.MINOR.PATCH format.
+// Development builds satisfy any requirement.
+func versionAtLeast(have, want string) bool {
+	if have == "(devel)" {
+		return true
+	}
+
+	parse := func(v string) [3]int {
+		var parts [3]int
+
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.IndexAny(v, "-+"); i != -1 {
+			v = v[:i]
+		}
+
+		for i, s := range strings.SplitN(v, ".", 3) {
+			parts[i], _ = strconv.Atoi(s)
+		}
+
+		return parts
+	}
+
+	h, w := parse(have), parse(want)
+	for i := range h {
+		if h[i] != w[i] {
+			return h[i] > w[i]
+		}
+	}
+
+	return true
+}
+
+// Plugins returns information on all plugins found on startup
+// indexed by their names, including the ones that failed to load.
+func Plugins() map[string]PluginInfo {
+	pluginInfosMu.RLock()
+	defer pluginInfosMu.RUnlock()
+
+	infos := make(map[string]PluginInfo)
+	for name, info := range pluginInfos {
+		infos[name] = info
+	}
+
+	return infos
+}
+
+// PluginConfig decodes the configuration section of the specified plugin
+// (`Plugins[name]` in the config) into v.
+// It returns ErrNoPluginConfig if the section doesn't exist.
+func PluginConfig(name string, v interface{}) error {
+	raw, ok := Conf().Plugins[name]
+	if !ok {
+		return ErrNoPluginConfig
+	}
+
+	return json.Unmarshal(raw, v)
 }
 
 func goCmd(args ...string) error {
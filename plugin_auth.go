@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+)
+
+var onPreAuth []func(*ClientConn) string
+var onPreAuthMu sync.RWMutex
+
+var onPostAuth []func(*ClientConn) string
+var onPostAuthMu sync.RWMutex
+
+// RegisterOnPreAuth registers a handler that is called
+// when a ClientConn has passed the builtin login checks
+// (name, ban, duplicate and user limit) but hasn't authenticated yet.
+// The ClientConn already has its name and network address set.
+// If the handler returns a non-empty string the ClientConn is kicked
+// using it as the reason and no further handlers are called.
+func RegisterOnPreAuth(handler func(cc *ClientConn) (deny string)) {
+	onPreAuthMu.Lock()
+	defer onPreAuthMu.Unlock()
+
+	onPreAuth = append(onPreAuth, handler)
+}
+
+// RegisterOnPostAuth registers a handler that is called
+// when a ClientConn has proven its password or is about to register
+// a new account, before authentication is confirmed to the client.
+// It works like the handlers registered using RegisterOnPreAuth.
+// New accounts are not created if a handler denies access.
+func RegisterOnPostAuth(handler func(cc *ClientConn) (deny string)) {
+	onPostAuthMu.Lock()
+	defer onPostAuthMu.Unlock()
+
+	onPostAuth = append(onPostAuth, handler)
+}
+
+func handlePreAuth(cc *ClientConn) string {
+	onPreAuthMu.RLock()
+	handlers := slices.Clone(onPreAuth)
+	onPreAuthMu.RUnlock()
+
+	for _, handler := range handlers {
+		if deny := handler(cc); deny != "" {
+			return deny
+		}
+	}
+
+	return ""
+}
+
+func handlePostAuth(cc *ClientConn) string {
+	onPostAuthMu.RLock()
+	handlers := slices.Clone(onPostAuth)
+	onPostAuthMu.RUnlock()
+
+	for _, handler := range handlers {
+		if deny := handler(cc); deny != "" {
+			return deny
+		}
+	}
+
+	return ""
+}
@@ -1,23 +1,135 @@
 package proxy
 
 import (
+	"strings"
 	"sync"
+	"time"
 )
 
+// A ChatCmdArgType specifies what values a ChatCmdArg accepts.
+type ChatCmdArgType uint8
+
+const (
+	StringArg ChatCmdArgType = iota
+	IntArg
+	FloatArg
+	BoolArg
+	PlayerArg // name of a connected player
+	ServerArg // name of a configured server
+)
+
+var chatCmdArgTypes = map[ChatCmdArgType]string{
+	StringArg: "string",
+	IntArg:    "integer",
+	FloatArg:  "number",
+	BoolArg:   "boolean",
+	PlayerArg: "player",
+	ServerArg: "server",
+}
+
+func (t ChatCmdArgType) String() string {
+	if s, ok := chatCmdArgTypes[t]; ok {
+		return s
+	}
+
+	return "unknown"
+}
+
+// A ChatCmdArg declares an argument of a ChatCmd.
+// Optional arguments must come after all required arguments.
+// Only the last argument may be variadic, in which case
+// it accepts any number of values (at least one if not optional).
+type ChatCmdArg struct {
+	Name     string
+	Type     ChatCmdArgType
+	Optional bool
+	Variadic bool
+}
+
+func (arg ChatCmdArg) String() string {
+	name := arg.Name
+	if arg.Variadic {
+		name += "..."
+	}
+
+	if arg.Optional {
+		return "[" + name + "]"
+	}
+
+	return "<" + name + ">"
+}
+
 // A ChatCmd holds information on how to handle a chat command.
+//
+// If Args is set the arguments are validated before the Handler
+// is called and the user receives a usage error if they don't match.
+// If Usage is empty it is generated from Args.
+// If the first argument is the name or an alias of one of the SubCmds,
+// the subcommand is executed with the remaining arguments instead.
+// Subcommands require the permissions of their parents.
+// The Handler may be nil if the command has subcommands.
+// A non-zero Cooldown is the time a user has to wait
+// before they can use the command again.
 type ChatCmd struct {
-	Name    string
-	Perm    string
-	Help    string
-	Usage   string
-	Handler func(*ClientConn, ...string) string
+	Name     string
+	Aliases  []string
+	Perm     string
+	Help     string
+	Usage    string
+	Args     []ChatCmdArg
+	SubCmds  []ChatCmd
+	Cooldown time.Duration
+	Handler  func(*ClientConn, ...string) string
+}
+
+// FullUsage returns the Usage of the ChatCmd
+// or generates it from its Args and SubCmds if it's empty.
+func (cmd ChatCmd) FullUsage() string {
+	if cmd.Usage != "" {
+		return cmd.Usage
+	}
+
+	usage := []string{cmd.Name}
+	if len(cmd.SubCmds) > 0 && cmd.Handler == nil {
+		var names []string
+		for _, sub := range cmd.SubCmds {
+			names = append(names, sub.Name)
+		}
+
+		usage = append(usage, "<"+strings.Join(names, " | ")+">")
+	}
+
+	for _, arg := range cmd.Args {
+		usage = append(usage, arg.String())
+	}
+
+	return strings.Join(usage, " ")
+}
+
+// subCmd returns the subcommand with the specified name or alias.
+func (cmd ChatCmd) subCmd(name string) (ChatCmd, bool) {
+	for _, sub := range cmd.SubCmds {
+		if sub.Name == name {
+			return sub, true
+		}
+
+		for _, alias := range sub.Aliases {
+			if alias == name {
+				return sub, true
+			}
+		}
+	}
+
+	return ChatCmd{}, false
 }
 
 var chatCmds map[string]ChatCmd
+var chatCmdAliases map[string]string
 var chatCmdsMu sync.RWMutex
 var chatCmdsOnce sync.Once
 
 // ChatCmds returns a map of all ChatCmds indexed by their names.
+// Aliases are not included.
 func ChatCmds() map[string]ChatCmd {
 	initChatCmds()
 
@@ -33,32 +145,83 @@ func ChatCmds() map[string]ChatCmd {
 }
 
 // ChatCmdExists reports if a ChatCmd exists.
+// The name may also be an alias.
 func ChatCmdExists(name string) bool {
-	_, ok := ChatCmds()[name]
+	_, ok := lookupChatCmd(name)
 	return ok
 }
 
 // RegisterChatCmd adds a new ChatCmd. It returns true on success
-// and false if a command with the same name already exists.
+// and false if a command with the same name or alias already exists.
 func RegisterChatCmd(cmd ChatCmd) bool {
 	initChatCmds()
 
-	if ChatCmdExists(cmd.Name) {
-		return false
+	chatCmdsMu.Lock()
+	defer chatCmdsMu.Unlock()
+
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if _, ok := chatCmds[name]; ok {
+			return false
+		}
+
+		if _, ok := chatCmdAliases[name]; ok {
+			return false
+		}
 	}
 
+	chatCmds[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		chatCmdAliases[alias] = cmd.Name
+	}
+
+	return true
+}
+
+// UnregisterChatCmd removes a ChatCmd and its aliases.
+// It returns false if the command doesn't exist.
+// The name may not be an alias.
+func UnregisterChatCmd(name string) bool {
+	initChatCmds()
+
 	chatCmdsMu.Lock()
 	defer chatCmdsMu.Unlock()
 
-	chatCmds[cmd.Name] = cmd
+	cmd, ok := chatCmds[name]
+	if !ok {
+		return false
+	}
+
+	delete(chatCmds, name)
+	for _, alias := range cmd.Aliases {
+		delete(chatCmdAliases, alias)
+	}
+
+	rmChatCmdCooldowns(name)
 	return true
 }
 
+// lookupChatCmd returns the ChatCmd with the specified name or alias.
+func lookupChatCmd(name string) (ChatCmd, bool) {
+	initChatCmds()
+
+	chatCmdsMu.RLock()
+	defer chatCmdsMu.RUnlock()
+
+	if alias, ok := chatCmdAliases[name]; ok {
+		name = alias
+	}
+
+	cmd, ok := chatCmds[name]
+	return cmd, ok
+}
+
 func initChatCmds() {
 	chatCmdsOnce.Do(func() {
 		chatCmdsMu.Lock()
 		defer chatCmdsMu.Unlock()
 
 		chatCmds = make(map[string]ChatCmd)
+		chatCmdAliases = make(map[string]string)
 	})
 }
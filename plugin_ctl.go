@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// A CtlHandler handles a request of a specific type received
+// on the control channel. The ClientConn is the player the request
+// was sent for. The raw message contains the whole request.
+// The result is encoded as JSON and sent back to the server
+// along with the error, if any.
+type CtlHandler func(cc *ClientConn, msg json.RawMessage) (result interface{}, err error)
+
+var ctlHandlers = make(map[string]CtlHandler)
+var ctlHandlersMu sync.RWMutex
+
+// RegisterCtlHandler registers a handler for control channel requests
+// of the specified type. It returns false if the type is already handled.
+// See doc/ctlchannel.md for the protocol.
+func RegisterCtlHandler(typ string, handler CtlHandler) bool {
+	ctlHandlersMu.Lock()
+	defer ctlHandlersMu.Unlock()
+
+	if _, ok := ctlHandlers[typ]; ok {
+		return false
+	}
+
+	ctlHandlers[typ] = handler
+	return true
+}
+
+func ctlHandler(typ string) (CtlHandler, bool) {
+	ctlHandlersMu.RLock()
+	defer ctlHandlersMu.RUnlock()
+
+	handler, ok := ctlHandlers[typ]
+	return handler, ok
+}
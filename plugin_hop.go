@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+)
+
+var onHopStart []func(*ClientConn, string, string)
+var onHopStartMu sync.RWMutex
+
+var onHopDone []func(*ClientConn, string, string)
+var onHopDoneMu sync.RWMutex
+
+var onHopFail []func(*ClientConn, string, string, error)
+var onHopFailMu sync.RWMutex
+
+// RegisterOnHopStart registers a handler that is called
+// when a ClientConn starts switching from one upstream server to another.
+// The handler is called before the hop is attempted
+// and may not hop the ClientConn itself.
+func RegisterOnHopStart(handler func(cc *ClientConn, from, to string)) {
+	onHopStartMu.Lock()
+	defer onHopStartMu.Unlock()
+
+	onHopStart = append(onHopStart, handler)
+}
+
+// RegisterOnHopDone registers a handler that is called
+// when a ClientConn has been connected to a new upstream server.
+func RegisterOnHopDone(handler func(cc *ClientConn, from, to string)) {
+	onHopDoneMu.Lock()
+	defer onHopDoneMu.Unlock()
+
+	onHopDone = append(onHopDone, handler)
+}
+
+// RegisterOnHopFail registers a handler that is called
+// when a ClientConn could not be connected to a new upstream server.
+// This happens once per failed attempt, so each fallback server
+// that can't be reached results in another call.
+func RegisterOnHopFail(handler func(cc *ClientConn, from, to string, err error)) {
+	onHopFailMu.Lock()
+	defer onHopFailMu.Unlock()
+
+	onHopFail = append(onHopFail, handler)
+}
+
+func handleHopStart(cc *ClientConn, from, to string) {
+	onHopStartMu.RLock()
+	handlers := slices.Clone(onHopStart)
+	onHopStartMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc, from, to)
+	}
+}
+
+func handleHopDone(cc *ClientConn, from, to string) {
+	onHopDoneMu.RLock()
+	handlers := slices.Clone(onHopDone)
+	onHopDoneMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc, from, to)
+	}
+}
+
+func handleHopFail(cc *ClientConn, from, to string, err error) {
+	onHopFailMu.RLock()
+	handlers := slices.Clone(onHopFail)
+	onHopFailMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc, from, to, err)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+)
+
+// A LeaveType indicates why a ClientConn left the proxy.
+type LeaveType uint8
+
+const (
+	Exit LeaveType = iota
+	Timeout
+)
+
+var onJoin []func(*ClientConn)
+var onJoinMu sync.RWMutex
+
+var onAuth []func(*ClientConn)
+var onAuthMu sync.RWMutex
+
+var onLeave []func(*ClientConn, LeaveType)
+var onLeaveMu sync.RWMutex
+
+// RegisterOnJoin registers a handler that is called
+// when a ClientConn has completed the initial handshake
+// and is about to be connected to its first upstream server.
+func RegisterOnJoin(handler func(cc *ClientConn)) {
+	onJoinMu.Lock()
+	defer onJoinMu.Unlock()
+
+	onJoin = append(onJoin, handler)
+}
+
+// RegisterOnAuth registers a handler that is called
+// when a ClientConn has successfully authenticated
+// or registered a new account.
+func RegisterOnAuth(handler func(cc *ClientConn)) {
+	onAuthMu.Lock()
+	defer onAuthMu.Unlock()
+
+	onAuth = append(onAuth, handler)
+}
+
+// RegisterOnLeave registers a handler that is called
+// when a ClientConn that has previously joined disconnects
+// or times out.
+func RegisterOnLeave(handler func(cc *ClientConn, lt LeaveType)) {
+	onLeaveMu.Lock()
+	defer onLeaveMu.Unlock()
+
+	onLeave = append(onLeave, handler)
+}
+
+// handleJoin calls the join handlers. Like all handler lists,
+// they are copied so that the lock isn't held while they run
+// and they can register further handlers.
+func handleJoin(cc *ClientConn) {
+	onJoinMu.RLock()
+	handlers := slices.Clone(onJoin)
+	onJoinMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc)
+	}
+}
+
+func handleAuth(cc *ClientConn) {
+	onAuthMu.RLock()
+	handlers := slices.Clone(onAuth)
+	onAuthMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc)
+	}
+}
+
+func handleLeave(cc *ClientConn, lt LeaveType) {
+	onLeaveMu.RLock()
+	handlers := slices.Clone(onLeave)
+	onLeaveMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc, lt)
+	}
+}
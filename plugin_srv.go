@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+)
+
+var onSrvLost []func(*ClientConn, string, error)
+var onSrvLostMu sync.RWMutex
+
+// RegisterOnSrvLost registers a handler that is called
+// when the connection to an upstream server is closed unexpectedly
+// while a ClientConn is still attached to it.
+// The error is the reason the connection was closed
+// and may be nil if the server closed it gracefully.
+// The handler is called before any fallback servers are tried.
+func RegisterOnSrvLost(handler func(cc *ClientConn, srv string, err error)) {
+	onSrvLostMu.Lock()
+	defer onSrvLostMu.Unlock()
+
+	onSrvLost = append(onSrvLost, handler)
+}
+
+func handleSrvLost(cc *ClientConn, srv string, err error) {
+	onSrvLostMu.RLock()
+	handlers := slices.Clone(onSrvLost)
+	onSrvLostMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(cc, srv, err)
+	}
+}
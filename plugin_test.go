@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolvePlugins(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins []PluginManifest
+		order   []string
+		// errs maps plugin names to their expected error messages.
+		// Duplicates are suffixed with #2.
+		errs map[string]string
+	}{
+		{
+			name:  "empty",
+			order: nil,
+		},
+		{
+			name: "independent",
+			plugins: []PluginManifest{
+				{Name: "b"},
+				{Name: "a"},
+			},
+			order: []string{"a", "b"},
+		},
+		{
+			name: "chain",
+			plugins: []PluginManifest{
+				{Name: "a", Depends: []string{"b"}},
+				{Name: "b", Depends: []string{"c"}},
+				{Name: "c"},
+			},
+			order: []string{"c", "b", "a"},
+		},
+		{
+			name: "diamond",
+			plugins: []PluginManifest{
+				{Name: "a", Depends: []string{"b", "c"}},
+				{Name: "b", Depends: []string{"d"}},
+				{Name: "c", Depends: []string{"d"}},
+				{Name: "d"},
+			},
+			order: []string{"d", "b", "c", "a"},
+		},
+		{
+			name: "missing",
+			plugins: []PluginManifest{
+				{Name: "a", Depends: []string{"x"}},
+				{Name: "b", Depends: []string{"a"}},
+				{Name: "c"},
+			},
+			order: []string{"a", "b", "c"},
+			errs: map[string]string{
+				"a": "missing dependency x",
+				"b": "dependency a failed: missing dependency x",
+			},
+		},
+		{
+			name: "self cycle",
+			plugins: []PluginManifest{
+				{Name: "a", Depends: []string{"a"}},
+			},
+			order: []string{"a"},
+			errs: map[string]string{
+				"a": ErrPluginDepCycle.Error(),
+			},
+		},
+		{
+			name: "cycle",
+			plugins: []PluginManifest{
+				{Name: "a", Depends: []string{"b"}},
+				{Name: "b", Depends: []string{"a"}},
+				{Name: "c", Depends: []string{"a"}},
+				{Name: "d"},
+			},
+			order: []string{"b", "a", "c", "d"},
+			errs: map[string]string{
+				"a": ErrPluginDepCycle.Error(),
+				"b": "dependency a failed: " + ErrPluginDepCycle.Error(),
+				"c": "dependency a failed: " + ErrPluginDepCycle.Error(),
+			},
+		},
+		{
+			name: "duplicate",
+			plugins: []PluginManifest{
+				{Name: "a"},
+				{Name: "b", Depends: []string{"a"}},
+				{Name: "a"},
+			},
+			order: []string{"a", "b", "a"},
+			errs: map[string]string{
+				"a#2": ErrPluginExists.Error(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var found []*pluginInfo
+		for _, m := range tt.plugins {
+			found = append(found, &pluginInfo{PluginInfo: PluginInfo{PluginManifest: m}})
+		}
+
+		var names []string
+		seen := make(map[string]bool)
+		for _, info := range resolvePlugins(found) {
+			names = append(names, info.Name)
+
+			key := info.Name
+			if seen[key] {
+				key += "#2"
+			}
+			seen[info.Name] = true
+
+			var err string
+			if info.Err != nil {
+				err = info.Err.Error()
+			}
+
+			if err != tt.errs[key] {
+				t.Errorf("%s: %s: got error %q, want %q", tt.name, key, err, tt.errs[key])
+			}
+		}
+
+		if !slices.Equal(names, tt.order) {
+			t.Errorf("%s: order = %q, want %q", tt.name, names, tt.order)
+		}
+	}
+
+	// Failed dependencies are wrapped.
+	found := []*pluginInfo{
+		{PluginInfo: PluginInfo{PluginManifest: PluginManifest{Name: "a", Depends: []string{"b"}}}},
+		{PluginInfo: PluginInfo{PluginManifest: PluginManifest{Name: "b", Depends: []string{"a"}}}},
+	}
+
+	for _, info := range resolvePlugins(found) {
+		if !errors.Is(info.Err, ErrPluginDepCycle) {
+			t.Errorf("cycle: %s: got error %v, want %v", info.Name, info.Err, ErrPluginDepCycle)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		have, want string
+		ok         bool
+	}{
+		{"(devel)", "v9.9.9", true},
+		{"v1.2.3", "v1.2.3", true},
+		{"v1.2.3", "1.2.3", true},
+		{"v1.2.4", "v1.2.3", true},
+		{"v1.3.0", "v1.2.9", true},
+		{"v2.0.0", "v1.9.9", true},
+		{"v1.2.3", "v1.2.4", false},
+		{"v1.2.3", "v1.10.0", false},
+		{"v1.2", "v1.2.0", true},
+		{"v1.2", "v1.2.1", false},
+		{"v1.2.3-0.20240101000000-abcdef", "v1.2.3", true},
+		{"v1.2.3+incompatible", "v1.2.3", true},
+		{"v0.0.0", "", true},
+	}
+
+	for _, tt := range tests {
+		if ok := versionAtLeast(tt.have, tt.want); ok != tt.ok {
+			t.Errorf("versionAtLeast(%q, %q) = %v, want %v", tt.have, tt.want, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// A poolNaming describes how the names of a media pool are prefixed.
+type poolNaming struct {
+	prefix string
+	exempt []string
+}
+
+// handTexture is the inventory image of the proxy's hand item.
+// Media pools can't use it without a prefix.
+const handTexture = "wieldhand.png"
+
+// poolNamings returns the naming settings of the media pools of a Config.
+// Pools that aren't configured explicitly are missing.
+func poolNamings(cnf Config) map[string]poolNaming {
+	namings := make(map[string]poolNaming)
+	for name, pool := range cnf.MediaPools {
+		naming := poolNaming{
+			prefix: pool.Prefix,
+			exempt: append([]string{}, pool.Exempt...),
+		}
+
+		if naming.prefix == "" {
+			naming.prefix = name
+		}
+
+		if pool.NoPrefix {
+			naming.prefix = ""
+		} else {
+			naming.prefix += "_"
+		}
+
+		namings[name] = naming
+	}
+
+	return namings
+}
+
+// checkPoolNamings returns an error if the naming settings
+// of a Config can make names of different media pools collide.
+func checkPoolNamings(cnf Config) error {
+	pools := make(map[string]struct{})
+	for pool := range cnf.Pools() {
+		pools[pool] = struct{}{}
+	}
+
+	for pool := range cnf.MediaPools {
+		pools[pool] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(pools))
+	for pool := range pools {
+		sorted = append(sorted, pool)
+	}
+	slices.Sort(sorted)
+
+	names := &contentNames{namings: poolNamings(cnf)}
+
+	var unprefixed string
+	prefixes := make(map[string]string)
+	for _, pool := range sorted {
+		naming := names.naming(pool)
+
+		for _, pattern := range naming.exempt {
+			ok, err := path.Match(pattern, handTexture)
+			if err != nil {
+				return fmt.Errorf("media pool %s: exempt pattern %q: %w", pool, pattern, err)
+			}
+
+			if ok {
+				return fmt.Errorf("media pool %s must not exempt %s", pool, handTexture)
+			}
+		}
+
+		if naming.prefix == "" {
+			if unprefixed != "" {
+				return fmt.Errorf("media pools %s and %s are both unprefixed", unprefixed, pool)
+			}
+
+			unprefixed = pool
+			continue
+		}
+
+		if other, ok := prefixes[naming.prefix]; ok {
+			return fmt.Errorf("media pools %s and %s have the same prefix %s", other, pool, naming.prefix)
+		}
+
+		prefixes[naming.prefix] = pool
+
+		// Unprefixed pools fall back to their name for reserved names.
+		other := strings.TrimSuffix(naming.prefix, "_")
+		if _, ok := pools[other]; ok && other != pool {
+			return fmt.Errorf("prefix %s of media pool %s is the name of media pool %s", naming.prefix, pool, other)
+		}
+	}
+
+	for i, pool := range sorted {
+		for _, other := range sorted[i+1:] {
+			if err := checkExemptOverlap(names, pool, other); err != nil {
+				return err
+			}
+
+			if err := checkExemptOverlap(names, other, pool); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkExemptOverlap returns an error if a name exempted
+// by a media pool can also be used by another media pool,
+// either because it is exempted there as well
+// or because it starts with the prefix of the other pool.
+func checkExemptOverlap(names *contentNames, pool, other string) error {
+	naming := names.naming(pool)
+	otherNaming := names.naming(other)
+
+	for _, pattern := range naming.exempt {
+		if otherNaming.prefix == "" {
+			return fmt.Errorf("media pool %s exempts %q but media pool %s is unprefixed", pool, pattern, other)
+		}
+
+		overlap, err := globsOverlap(pattern, quoteGlob(otherNaming.prefix)+"*")
+		if err != nil {
+			return fmt.Errorf("media pool %s: exempt pattern %q: %w", pool, pattern, err)
+		}
+
+		if overlap {
+			return fmt.Errorf("exempt pattern %q of media pool %s overlaps with prefix %s of media pool %s", pattern, pool, otherNaming.prefix, other)
+		}
+
+		for _, otherPattern := range otherNaming.exempt {
+			overlap, err := globsOverlap(pattern, otherPattern)
+			if err != nil {
+				return fmt.Errorf("media pool %s: exempt pattern %q: %w", other, otherPattern, err)
+			}
+
+			if overlap {
+				return fmt.Errorf("exempt patterns %q of media pool %s and %q of media pool %s overlap", pattern, pool, otherPattern, other)
+			}
+		}
+	}
+
+	return nil
+}
+
+// naming returns the naming settings of a media pool.
+func (n *contentNames) naming(pool string) poolNaming {
+	if n != nil {
+		if naming, ok := n.namings[pool]; ok {
+			return naming
+		}
+	}
+
+	return poolNaming{prefix: pool + "_"}
+}
+
+// PoolPrefix returns the string the names of a media pool
+// are prefixed with according to the current configuration.
+// It is empty if the pool isn't prefixed.
+// Connected clients keep the prefixes their content was multiplexed with.
+func PoolPrefix(pool string) string {
+	names := &contentNames{namings: poolNamings(Conf())}
+	return names.naming(pool).prefix
+}
+
+// prefixNameRaw returns the name a media pool uses for a name
+// on the client without taking shared names and media aliases
+// into account.
+func (n *contentNames) prefixNameRaw(pool, name string) string {
+	if isDefaultNode(name) {
+		return name
+	}
+
+	naming := n.naming(pool)
+	if name == handTexture {
+		if naming.prefix == "" {
+			return pool + "_" + name
+		}
+
+		return naming.prefix + name
+	}
+
+	for _, pattern := range naming.exempt {
+		if ok, _ := path.Match(pattern, name); ok {
+			return name
+		}
+	}
+
+	return naming.prefix + name
+}
+
+// name returns the name the media pool of the prefixer
+// uses for a name on the client.
+func (p prefixer) name(name string) string {
+	if p.names.isShared(p.pool, name) {
+		return name
+	}
+
+	return p.names.mediaAlias(p.names.prefixNameRaw(p.pool, name))
+}
+
+// setSrvNames records the names the content of the contentConns
+// has on the client so that they can be translated back.
+// It must be called after media aliases and shared names are known.
+func (n *contentNames) setSrvNames(conns []*contentConn) {
+	n.srvNames = make(map[string]map[string]string)
+	add := func(pool, name string) {
+		if name == "" {
+			return
+		}
+
+		if clientName := n.prefixer(pool).name(name); clientName != name {
+			n.srvNames[pool][clientName] = name
+		}
+	}
+
+	for _, cc := range conns {
+		<-cc.done()
+		if !cc.success {
+			continue
+		}
+
+		n.srvNames[cc.mediaPool] = make(map[string]string)
+
+		for _, def := range cc.itemDefs {
+			add(cc.mediaPool, def.Name)
+		}
+
+		for _, def := range cc.nodeDefs {
+			add(cc.mediaPool, def.Name)
+		}
+
+		for _, alias := range cc.aliases {
+			add(cc.mediaPool, alias.Alias)
+		}
+	}
+}
+
+// srvName reverses prefixName for the nodes, items and aliases
+// of a media pool. Other names are returned unchanged.
+func (n *contentNames) srvName(pool, name string) string {
+	if n == nil {
+		return name
+	}
+
+	if orig, ok := n.srvNames[pool][name]; ok {
+		return orig
+	}
+
+	return name
+}
+
+// srvNameValue translates a value that is either a name
+// or an item string as a whole. Other values,
+// including names that are part of a text, are returned unchanged.
+func (n *contentNames) srvNameValue(pool, value string) string {
+	name, rest, ok := strings.Cut(value, " ")
+	if !ok {
+		return n.srvName(pool, value)
+	}
+
+	// Item strings consist of the name, the count and the wear.
+	for _, field := range strings.Split(rest, " ") {
+		if _, err := strconv.ParseUint(field, 10, 16); err != nil {
+			return value
+		}
+	}
+
+	return n.srvName(pool, name) + " " + rest
+}
+
+// unprefixCmd translates the names of a command
+// sent by the client back to the names the server uses.
+// ToSrvInvAction only references inventory locations and
+// ToSrvInteract only the slot of the wielded item,
+// so they don't need to be translated.
+func (sc *ServerConn) unprefixCmd(cmd mt.Cmd) {
+	switch cmd := cmd.(type) {
+	case *mt.ToSrvInvFields:
+		sc.unprefixFields(cmd.Fields)
+	case *mt.ToSrvNodeMetaFields:
+		sc.unprefixFields(cmd.Fields)
+	case *mt.ToSrvChatMsg:
+		// Only chat commands are likely to take names as arguments.
+		if strings.HasPrefix(cmd.Msg, "/") {
+			cmd.Msg = sc.unprefixArgs(cmd.Msg)
+		}
+	}
+}
+
+// unprefixFields translates the values of formspec fields.
+// Field names are chosen by the server and never prefixed.
+func (sc *ServerConn) unprefixFields(fields []mt.Field) {
+	names := sc.clientNames()
+	for i := range fields {
+		fields[i].Value = names.srvNameValue(sc.mediaPool, fields[i].Value)
+	}
+}
+
+// unprefixArgs translates the arguments of a chat command
+// that are names as a whole. The command itself
+// and the spacing are left untouched.
+func (sc *ServerConn) unprefixArgs(msg string) string {
+	names := sc.clientNames()
+	args := strings.Split(msg, " ")
+	for i := 1; i < len(args); i++ {
+		args[i] = names.srvName(sc.mediaPool, args[i])
+	}
+
+	return strings.Join(args, " ")
+}
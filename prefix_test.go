@@ -0,0 +1,64 @@
+package proxy
+
+import "testing"
+
+func TestCheckPoolNamings(t *testing.T) {
+	tests := []struct {
+		name  string
+		pools map[string]MediaPool
+		ok    bool
+	}{
+		{"default", nil, true},
+		{"one unprefixed", map[string]MediaPool{"a": {NoPrefix: true}}, true},
+		{"two unprefixed", map[string]MediaPool{"a": {NoPrefix: true}, "b": {NoPrefix: true}}, false},
+		{"same prefix", map[string]MediaPool{"a": {Prefix: "x"}, "b": {Prefix: "x"}}, false},
+		{"prefix of other pool", map[string]MediaPool{"a": {Prefix: "b"}}, false},
+		{"exempt hand", map[string]MediaPool{"a": {Exempt: []string{"*.png"}}}, false},
+		{"bad pattern", map[string]MediaPool{"a": {Exempt: []string{"["}}}, false},
+		{"disjoint exempts", map[string]MediaPool{"a": {Exempt: []string{"default:*"}}, "b": {Exempt: []string{"farming:*"}}}, true},
+		{"overlapping exempts", map[string]MediaPool{"a": {Exempt: []string{"default:*"}}, "b": {Exempt: []string{"*:stone"}}}, false},
+		{"exempt prefix", map[string]MediaPool{"a": {Exempt: []string{"b_*"}}}, false},
+		{"exempt and unprefixed", map[string]MediaPool{"a": {Exempt: []string{"default:*"}}, "b": {NoPrefix: true}}, false},
+	}
+
+	for _, tt := range tests {
+		cnf := Config{
+			Servers: map[string]Server{
+				"a": {MediaPool: "a"},
+				"b": {MediaPool: "b"},
+			},
+			MediaPools: tt.pools,
+		}
+
+		if err := checkPoolNamings(cnf); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestPrefixNameRaw(t *testing.T) {
+	names := &contentNames{namings: poolNamings(Config{
+		MediaPools: map[string]MediaPool{
+			"a": {NoPrefix: true},
+			"b": {Prefix: "x", Exempt: []string{"default:*"}},
+		},
+	})}
+
+	tests := []struct {
+		pool, name, want string
+	}{
+		{"a", "default:stone", "default:stone"},
+		{"a", "wieldhand.png", "a_wieldhand.png"},
+		{"b", "default:stone", "default:stone"},
+		{"b", "farming:wheat", "x_farming:wheat"},
+		{"b", "wieldhand.png", "x_wieldhand.png"},
+		{"b", "air", "air"},
+		{"c", "default:stone", "c_default:stone"},
+	}
+
+	for _, tt := range tests {
+		if got := names.prefixNameRaw(tt.pool, tt.name); got != tt.want {
+			t.Errorf("prefixNameRaw(%q, %q) = %q, want %q", tt.pool, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import "sort"
+
+// privsMsg is sent on the control channel to tell the server mod
+// which privileges a player should have. Managed lists all privileges
+// controlled by the proxy. Managed privileges that aren't in Privs
+// must be revoked.
+type privsMsg struct {
+	Type    string   `json:"type"`
+	Privs   []string `json:"privs"`
+	Managed []string `json:"managed"`
+}
+
+// PlayerPrivs returns the upstream privileges a player receives
+// from their permission groups according to the GroupPrivs config option.
+// Privileges of inherited groups are included.
+func PlayerPrivs(name string) []string {
+	conf := Conf()
+
+	privs := make(map[string]struct{})
+	for _, grp := range playerGroupsInherited(conf, name) {
+		for _, priv := range conf.GroupPrivs[grp] {
+			privs[priv] = struct{}{}
+		}
+	}
+
+	return sortedKeys(privs)
+}
+
+// SyncPrivs pushes the privileges of the ClientConn
+// to its current upstream server. It does nothing
+// if the GroupPrivs config option is empty.
+// Privileges are synced automatically when connecting to a server,
+// when the groups of a player are changed using AddUserGroup
+// or RmUserGroup and when a temporary group assignment expires.
+func (cc *ClientConn) SyncPrivs() {
+	if sc := cc.server(); sc != nil {
+		sc.syncPrivs()
+	}
+}
+
+func (sc *ServerConn) syncPrivs() {
+	clt := sc.client()
+	if clt == nil {
+		return
+	}
+
+	groupPrivs := Conf().GroupPrivs
+	if len(groupPrivs) == 0 {
+		return
+	}
+
+	managed := make(map[string]struct{})
+	for _, privs := range groupPrivs {
+		for _, priv := range privs {
+			managed[priv] = struct{}{}
+		}
+	}
+
+	if err := sc.sendCtlMsg(privsMsg{
+		Type:    "privs",
+		Privs:   PlayerPrivs(clt.Name()),
+		Managed: sortedKeys(managed),
+	}); err != nil {
+		sc.Log("->", "sync privs:", err)
+	}
+}
+
+func syncPlayerPrivs(name string) {
+	if cc := Find(name); cc != nil {
+		go cc.SyncPrivs()
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -20,6 +20,7 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 			return
 		}
 
+		srv.unprefixCmd(pkt.Cmd)
 		srv.Send(pkt)
 	}
 
@@ -126,6 +127,12 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 			return
 		}
 
+		if Conf().Whitelist.Enable && !Whitelisted(cc.Name()) {
+			cc.Log("<-", "not whitelisted")
+			cc.Kick(Conf().Whitelist.Msg)
+			return
+		}
+
 		// user limit
 		if len(players) >= Conf().UserLimit {
 			cc.Log("<-", "player limit reached")
@@ -140,6 +147,12 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 			return
 		}
 
+		if reason := handlePreAuth(cc); reason != "" {
+			cc.Log("<-", "deny login", reason)
+			cc.Kick(reason)
+			return
+		}
+
 		// reply
 		if authIface.Exists(cc.Name()) {
 			cc.auth.method = mt.SRP
@@ -188,6 +201,12 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 				return
 			}
 
+			if reason := handlePostAuth(cc); reason != "" {
+				cc.Log("<-", "deny registration", reason)
+				cc.Kick(reason)
+				return
+			}
+
 			if err := authIface.SetPasswd(cc.Name(), cmd.Salt, cmd.Verifier); err != nil {
 				cc.Log("<-", "set password fail")
 				ack, _ := cc.SendCmd(&mt.ToCltKick{Reason: mt.SrvErr})
@@ -208,6 +227,8 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 				SendInterval:    Conf().SendInterval,
 				SudoAuthMethods: mt.SRP,
 			})
+
+			handleAuth(cc)
 		} else {
 			if cc.state() < csSudo {
 				cc.Log("->", "unauthorized sudo action")
@@ -331,12 +352,20 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 				cc.setState(csSudo)
 				cc.SendCmd(&mt.ToCltAcceptSudoMode{})
 			} else {
+				if reason := handlePostAuth(cc); reason != "" {
+					cc.Log("<-", "deny login", reason)
+					cc.Kick(reason)
+					return
+				}
+
 				cc.SendCmd(&mt.ToCltAcceptAuth{
 					PlayerPos:       mt.Pos{0, 5, 0},
 					MapSeed:         0,
 					SendInterval:    Conf().SendInterval,
 					SudoAuthMethods: mt.SRP,
 				})
+
+				handleAuth(cc)
 			}
 		} else {
 			if wantSudo {
@@ -359,15 +388,22 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 
 		return
 	case *mt.ToSrvInit2:
-		var remotes []string
-		var err error
-		cc.denyPools, cc.itemDefs, cc.aliases, cc.nodeDefs, cc.p0Map, cc.p0SrvMap, cc.media, remotes, err = muxContent(cc.Name())
+		mux, err := cachedMuxContent(cc.Name())
 		if err != nil {
 			cc.Log("<-", err.Error())
 			cc.Kick("Content multiplexing failed.")
 			return
 		}
 
+		cc.denyPools, cc.itemDefs, cc.aliases, cc.nodeDefs = mux.denyPools, mux.itemDefs, mux.aliases, mux.nodeDefs
+		cc.p0Map, cc.p0SrvMap, cc.media, cc.names = mux.p0Map, mux.p0SrvMap, mux.media, mux.names
+
+		var remotes []string
+		if url := mediaServerURL(); url != "" {
+			remotes = append(remotes, url)
+		}
+		remotes = append(remotes, mux.remotes...)
+
 		cc.SendCmd(&mt.ToCltItemDefs{
 			Defs:    cc.itemDefs,
 			Aliases: cc.aliases,
@@ -420,6 +456,9 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 	case *mt.ToSrvReqMedia:
 		cc.sendMedia(cmd.Filenames)
 		return
+	case *mt.ToSrvHaveMedia:
+		cc.haveDynMedia(cmd.Tokens)
+		return
 	case *mt.ToSrvCltReady:
 		cc.major = cmd.Major
 		cc.minor = cmd.Minor
@@ -470,6 +509,24 @@ func (cc *ClientConn) process(pkt mt.Pkt) {
 		}(done)
 
 		return
+	case *mt.ToSrvJoinModChan:
+		if cmd.Channel == CtlChannel {
+			cc.Log("->", "deny control channel join")
+			cc.SendCmd(&mt.ToCltModChanSig{
+				Signal:  mt.JoinFail,
+				Channel: cmd.Channel,
+			})
+			return
+		}
+	case *mt.ToSrvLeaveModChan:
+		if cmd.Channel == CtlChannel {
+			return
+		}
+	case *mt.ToSrvMsgModChan:
+		if cmd.Channel == CtlChannel {
+			cc.Log("->", "deny control channel message")
+			return
+		}
 	case *mt.ToSrvCltInfo:
 		// Store for any future hops (need to send it to the new server).
 		cc.cltInfo = cmd
@@ -609,6 +666,9 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 		sc.setState(csSudo)
 		return
 	case *mt.ToCltAnnounceMedia:
+		hashContent(sc.contentHash, cmd)
+		checkContentHash(sc.mediaPool, contentHashSum(sc.contentHash))
+
 		sc.SendCmd(&mt.ToSrvReqMedia{})
 
 		sc.SendCmd(&mt.ToSrvCltReady{
@@ -624,27 +684,18 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 		sc.setState(csActive)
 		close(sc.initCh)
 
+		sc.joinCtlChannel()
+
 		return
 	case *mt.ToCltMedia:
-		tokens := make([]uint32, 0, len(cmd.Files))
-		for i, f := range cmd.Files {
-			prepend(sc.mediaPool, &cmd.Files[i].Name)
-
-			dynInfo, ok := sc.dynMedia[f.Name]
-			if ok {
-				if dynInfo.cache {
-					cacheMedia(f.Data)
-				}
-
-				tokens = append(tokens, dynInfo.token)
-				delete(sc.dynMedia, f.Name)
-			}
-		}
-
-		sc.SendCmd(&mt.ToSrvHaveMedia{Tokens: tokens})
+		// The proxy only requests dynamic media after the handshake.
+		sc.handleDynMedia(cmd.Files)
+		return
 	case *mt.ToCltItemDefs:
+		hashContent(sc.contentHash, cmd)
 		return
 	case *mt.ToCltNodeDefs:
+		hashContent(sc.contentHash, cmd)
 		return
 	case *mt.ToCltInv:
 		var oldInv mt.Inv
@@ -654,7 +705,7 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 
 		handStack := mt.Stack{
 			Item: mt.Item{
-				Name: sc.mediaPool + "_hand",
+				Name: sc.prefixer().name("hand"),
 			},
 			Count: 1,
 		}
@@ -673,6 +724,10 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 			hand.Stacks = []mt.Stack{handStack}
 		}
 
+		sc.mu.Lock()
+		sc.handoffInv = copyInv(sc.inv)
+		sc.mu.Unlock()
+
 		b := &strings.Builder{}
 		sc.inv.SerializeKeep(b, oldInv)
 
@@ -760,43 +815,21 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 
 		return
 	case *mt.ToCltMediaPush:
-		filename := cmd.Filename
-		prepend(sc.mediaPool, &cmd.Filename)
-
-		var exit bool
-		for _, f := range clt.media {
-			if f.name == cmd.Filename {
-				exit = true
-				break
-			}
-		}
-
-		if exit {
-			break
-		}
-
-		sc.dynMedia[cmd.Filename] = struct {
-			token uint32
-			cache bool
-		}{
-			token: cmd.CallbackToken,
-			cache: cmd.ShouldCache,
-		}
-
-		sc.SendCmd(&mt.ToSrvReqMedia{Filenames: []string{filename}})
+		sc.handleMediaPush(cmd)
+		return
 	case *mt.ToCltSkyParams:
 		for i := range cmd.Textures {
-			prependTexture(sc.mediaPool, &cmd.Textures[i])
+			prependTexture(sc.prefixer(), &cmd.Textures[i])
 		}
 	case *mt.ToCltSunParams:
-		prependTexture(sc.mediaPool, &cmd.Texture)
-		prependTexture(sc.mediaPool, &cmd.ToneMap)
-		prependTexture(sc.mediaPool, &cmd.Rise)
+		prependTexture(sc.prefixer(), &cmd.Texture)
+		prependTexture(sc.prefixer(), &cmd.ToneMap)
+		prependTexture(sc.prefixer(), &cmd.Rise)
 	case *mt.ToCltMoonParams:
-		prependTexture(sc.mediaPool, &cmd.Texture)
-		prependTexture(sc.mediaPool, &cmd.ToneMap)
+		prependTexture(sc.prefixer(), &cmd.Texture)
+		prependTexture(sc.prefixer(), &cmd.ToneMap)
 	case *mt.ToCltSetHotbarParam:
-		prependTexture(sc.mediaPool, &cmd.Img)
+		prependTexture(sc.prefixer(), &cmd.Img)
 	case *mt.ToCltUpdatePlayerList:
 		if !clt.playerListInit {
 			clt.playerListInit = true
@@ -814,7 +847,7 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 			}
 		}
 	case *mt.ToCltSpawnParticle:
-		prependTexture(sc.mediaPool, &cmd.Texture)
+		prependTexture(sc.prefixer(), &cmd.Texture)
 		sc.globalParam0(&cmd.NodeParam0)
 	case *mt.ToCltBlkData:
 		for i := range cmd.Blk.Param0 {
@@ -833,14 +866,14 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 	case *mt.ToCltAddNode:
 		sc.globalParam0(&cmd.Node.Param0)
 	case *mt.ToCltAddParticleSpawner:
-		prependTexture(sc.mediaPool, &cmd.Texture)
+		prependTexture(sc.prefixer(), &cmd.Texture)
 		sc.swapAOID(&cmd.AttachedAOID)
 		sc.globalParam0(&cmd.NodeParam0)
 		sc.particleSpawners[cmd.ID] = struct{}{}
 	case *mt.ToCltDelParticleSpawner:
 		delete(sc.particleSpawners, cmd.ID)
 	case *mt.ToCltPlaySound:
-		prepend(sc.mediaPool, &cmd.Name)
+		prepend(sc.prefixer(), &cmd.Name)
 		sc.swapAOID(&cmd.SrcAOID)
 		if cmd.Loop {
 			sc.sounds[cmd.ID] = struct{}{}
@@ -857,7 +890,25 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 		sc.prependHUD(sc.huds[cmd.ID], cmd)
 	case *mt.ToCltRmHUD:
 		delete(sc.huds, cmd.ID)
+	case *mt.ToCltHP:
+		sc.mu.Lock()
+		sc.hp = &cmd.HP
+		sc.mu.Unlock()
+	case *mt.ToCltBreath:
+		sc.mu.Lock()
+		sc.breath = &cmd.Breath
+		sc.mu.Unlock()
+	case *mt.ToCltChatMsg:
+		if kind, target, ok := transferChatMsg(cmd); ok && sc.trusted() {
+			go sc.handleTransfer(kind, target)
+			return
+		}
 	case *mt.ToCltShowFormspec:
+		if kind, target, ok := transferFormspec(cmd); ok && sc.trusted() {
+			go sc.handleTransfer(kind, target)
+			return
+		}
+
 		sc.prependFormspec(&cmd.Formspec)
 	case *mt.ToCltFormspecPrepend:
 		sc.prependFormspec(&cmd.Prepend)
@@ -865,7 +916,17 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 		sc.prependFormspec(&cmd.Formspec)
 	case *mt.ToCltMinimapModes:
 		for i := range cmd.Modes {
-			prependTexture(sc.mediaPool, &cmd.Modes[i].Texture)
+			prependTexture(sc.prefixer(), &cmd.Modes[i].Texture)
+		}
+	case *mt.ToCltModChanMsg:
+		if cmd.Channel == CtlChannel {
+			// Messages sent by other players are copies
+			// of messages the proxy sent itself.
+			if cmd.Sender == "" {
+				go sc.handleCtlMsg(cmd.Msg)
+			}
+
+			return
 		}
 	case *mt.ToCltNodeMetasChanged:
 		for k := range cmd.Changed {
@@ -878,6 +939,11 @@ func (sc *ServerConn) process(pkt mt.Pkt) {
 			sc.prependInv(cmd.Changed[k].Inv)
 		}
 	case *mt.ToCltModChanSig:
+		if cmd.Channel == CtlChannel {
+			sc.handleCtlChannelSig(cmd)
+			return
+		}
+
 		switch cmd.Signal {
 		case mt.JoinOK:
 			if _, ok := clt.modChs[cmd.Channel]; ok {
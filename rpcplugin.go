@@ -0,0 +1,646 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/HimbeerserverDE/mt"
+	"github.com/HimbeerserverDE/mt-multiserver-proxy/rpcplugin"
+)
+
+// RPCPluginTimeout is the time the proxy waits for an RPC plugin
+// to reply to an event before giving up.
+var RPCPluginTimeout = 5 * time.Second
+
+// RPCPluginRestartDelay is the time the proxy waits
+// before restarting an RPC plugin that has exited.
+var RPCPluginRestartDelay = 5 * time.Second
+
+var (
+	ErrNoSuchRPCPlugin     = errors.New("inexistent RPC plugin")
+	ErrRPCPluginRunning    = errors.New("RPC plugin already running")
+	ErrRPCPluginNotRunning = errors.New("RPC plugin not running")
+	ErrRPCPluginClosed     = errors.New("RPC plugin connection closed")
+	ErrRPCPluginTimeout    = errors.New("RPC plugin timed out")
+)
+
+type rpcPlugin struct {
+	name string
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	stop bool
+	// token authenticates the running process.
+	// It is regenerated every time the plugin is started.
+	token string
+}
+
+type rpcPluginConn struct {
+	name   string
+	events chan rpcplugin.Event
+	closed chan struct{}
+	mu     sync.RWMutex
+
+	pending      map[uint64]chan rpcplugin.Reply
+	chatCmds     []string
+	interactions map[Interaction]struct{}
+	subs         map[string]struct{}
+}
+
+var rpcPlugins = make(map[string]*rpcPlugin)
+var rpcPluginsMu sync.RWMutex
+
+var rpcConns = make(map[*rpcPluginConn]struct{})
+var rpcConnsMu sync.RWMutex
+
+var rpcEventID atomic.Uint64
+var rpcPluginsOnce sync.Once
+
+// RPCPlugins returns the names of all RPC plugins
+// managed by the proxy and whether they are running.
+func RPCPlugins() map[string]bool {
+	rpcPluginsMu.RLock()
+	defer rpcPluginsMu.RUnlock()
+
+	plugins := make(map[string]bool)
+	for name, p := range rpcPlugins {
+		p.mu.Lock()
+		plugins[name] = p.cmd != nil
+		p.mu.Unlock()
+	}
+
+	return plugins
+}
+
+// StartRPCPlugin starts the RPC plugin executable with the specified
+// file name from the `rpcplugins` directory. It is restarted
+// automatically if it exits until StopRPCPlugin is called.
+func StartRPCPlugin(name string) error {
+	if !rpcPluginExists(name) {
+		return ErrNoSuchRPCPlugin
+	}
+
+	rpcPluginsMu.Lock()
+	defer rpcPluginsMu.Unlock()
+
+	p, ok := rpcPlugins[name]
+	if !ok {
+		p = &rpcPlugin{name: name}
+		rpcPlugins[name] = p
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd != nil {
+		return ErrRPCPluginRunning
+	}
+
+	p.stop = false
+	return p.start()
+}
+
+// StopRPCPlugin terminates an RPC plugin
+// without restarting it.
+func StopRPCPlugin(name string) error {
+	rpcPluginsMu.RLock()
+	p, ok := rpcPlugins[name]
+	rpcPluginsMu.RUnlock()
+
+	if !ok {
+		return ErrNoSuchRPCPlugin
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		return ErrRPCPluginNotRunning
+	}
+
+	p.stop = true
+	return p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// RestartRPCPlugin terminates an RPC plugin and starts it again
+// immediately, picking up any changes to its executable.
+func RestartRPCPlugin(name string) error {
+	if err := StopRPCPlugin(name); err != nil && !errors.Is(err, ErrRPCPluginNotRunning) {
+		return err
+	}
+
+	rpcPluginsMu.RLock()
+	p := rpcPlugins[name]
+	rpcPluginsMu.RUnlock()
+
+	p.mu.Lock()
+	cmd := p.cmd
+	p.mu.Unlock()
+
+	if cmd != nil {
+		// The supervisor clears cmd once the process has exited.
+		deadline := time.Now().Add(RPCPluginTimeout)
+		for {
+			p.mu.Lock()
+			done := p.cmd != cmd
+			p.mu.Unlock()
+
+			if done {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				cmd.Process.Kill()
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return StartRPCPlugin(name)
+}
+
+// rpcPluginExists reports whether name is the name
+// of an executable in the `rpcplugins` directory.
+// Paths are rejected so that only these executables can be run.
+func rpcPluginExists(name string) bool {
+	if strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return false
+	}
+
+	dir, err := os.ReadDir(Path("rpcplugins"))
+	if err != nil {
+		return false
+	}
+
+	for _, pl := range dir {
+		if pl.Name() == name && !pl.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validRPCPluginToken reports whether a token belongs
+// to the running process of the RPC plugin with the specified name.
+func validRPCPluginToken(name, token string) bool {
+	rpcPluginsMu.RLock()
+	p, ok := rpcPlugins[name]
+	rpcPluginsMu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) == 1
+}
+
+// The caller must hold p.mu.
+func (p *rpcPlugin) start() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	token := hex.EncodeToString(b)
+
+	cmd := exec.Command(Path("rpcplugins/", p.name))
+	cmd.Env = append(os.Environ(),
+		rpcplugin.SocketEnv+"="+Path("rpcplugins.sock"),
+		rpcplugin.NameEnv+"="+p.name,
+		rpcplugin.TokenEnv+"="+token,
+	)
+	cmd.Stdout = logWriter
+	cmd.Stderr = logWriter
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.token = token
+	log.Print("start rpc plugin ", p.name)
+
+	go p.supervise(cmd)
+	return nil
+}
+
+func (p *rpcPlugin) supervise(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == cmd {
+		p.cmd = nil
+		p.token = ""
+	}
+
+	if p.stop {
+		log.Print("stop rpc plugin ", p.name)
+		return
+	}
+
+	log.Print("rpc plugin ", p.name, " exited: ", err)
+
+	go func() {
+		time.Sleep(RPCPluginRestartDelay)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.stop || p.cmd != nil {
+			return
+		}
+
+		if err := p.start(); err != nil {
+			log.Print("rpc plugin ", p.name, ": ", err)
+		}
+	}()
+}
+
+func loadRPCPlugins() {
+	rpcPluginsOnce.Do(openRPCPlugins)
+}
+
+func openRPCPlugins() {
+	path := Path("rpcplugins")
+	os.Mkdir(path, 0777)
+
+	sockPath := Path("rpcplugins.sock")
+	os.Remove(sockPath)
+
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go acceptRPCPlugins(l)
+	registerRPCHooks()
+	registerRPCPluginCmd()
+
+	dir, err := os.ReadDir(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, pl := range dir {
+		if pl.IsDir() {
+			continue
+		}
+
+		if err := StartRPCPlugin(pl.Name()); err != nil {
+			log.Print("rpc plugin ", pl.Name(), ": ", err)
+		}
+	}
+
+	log.Print("load rpc plugins")
+}
+
+func stopRPCPlugins() {
+	for name, running := range RPCPlugins() {
+		if running {
+			StopRPCPlugin(name)
+		}
+	}
+}
+
+func acceptRPCPlugins(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Print(err)
+			continue
+		}
+
+		pc := &rpcPluginConn{
+			events:       make(chan rpcplugin.Event, 64),
+			closed:       make(chan struct{}),
+			pending:      make(map[uint64]chan rpcplugin.Reply),
+			interactions: make(map[Interaction]struct{}),
+			subs:         make(map[string]struct{}),
+		}
+
+		srv := rpc.NewServer()
+		srv.RegisterName(rpcplugin.Service, &rpcPluginService{pc: pc})
+
+		go func() {
+			srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+			pc.close()
+		}()
+	}
+}
+
+func (pc *rpcPluginConn) close() {
+	rpcConnsMu.Lock()
+	delete(rpcConns, pc)
+	rpcConnsMu.Unlock()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	for _, name := range pc.chatCmds {
+		UnregisterChatCmd(name)
+	}
+
+	close(pc.closed)
+
+	if pc.name != "" {
+		log.Print("rpc plugin ", pc.name, " disconnected")
+	}
+}
+
+func (pc *rpcPluginConn) subscribed(event string) bool {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	_, ok := pc.subs[event]
+	return ok
+}
+
+// notify sends an event that doesn't expect a reply.
+func (pc *rpcPluginConn) notify(ev rpcplugin.Event) {
+	select {
+	case pc.events <- ev:
+	case <-pc.closed:
+	case <-time.After(RPCPluginTimeout):
+		log.Print("rpc plugin ", pc.name, ": drop event ", ev.Type)
+	}
+}
+
+// call sends an event and waits for the reply.
+func (pc *rpcPluginConn) call(ev rpcplugin.Event) (rpcplugin.Reply, error) {
+	ev.ID = rpcEventID.Add(1)
+	ch := make(chan rpcplugin.Reply, 1)
+
+	pc.mu.Lock()
+	pc.pending[ev.ID] = ch
+	pc.mu.Unlock()
+
+	defer func() {
+		pc.mu.Lock()
+		delete(pc.pending, ev.ID)
+		pc.mu.Unlock()
+	}()
+
+	timeout := time.After(RPCPluginTimeout)
+
+	select {
+	case pc.events <- ev:
+	case <-pc.closed:
+		return rpcplugin.Reply{}, ErrRPCPluginClosed
+	case <-timeout:
+		return rpcplugin.Reply{}, ErrRPCPluginTimeout
+	}
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-pc.closed:
+		return rpcplugin.Reply{}, ErrRPCPluginClosed
+	case <-timeout:
+		return rpcplugin.Reply{}, ErrRPCPluginTimeout
+	}
+}
+
+func rpcSubscribers(event string) []*rpcPluginConn {
+	rpcConnsMu.RLock()
+	defer rpcConnsMu.RUnlock()
+
+	var conns []*rpcPluginConn
+	for pc := range rpcConns {
+		if pc.subscribed(event) {
+			conns = append(conns, pc)
+		}
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].name < conns[j].name
+	})
+
+	return conns
+}
+
+func rpcNotify(ev rpcplugin.Event) {
+	for _, pc := range rpcSubscribers(ev.Type) {
+		pc.notify(ev)
+	}
+}
+
+func rpcDeny(ev rpcplugin.Event) string {
+	for _, pc := range rpcSubscribers(ev.Type) {
+		reply, err := pc.call(ev)
+		if err != nil {
+			log.Print("rpc plugin ", pc.name, ": ", err)
+			continue
+		}
+
+		if reply.Result != "" {
+			return reply.Result
+		}
+	}
+
+	return ""
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+func registerRPCHooks() {
+	RegisterOnJoin(func(cc *ClientConn) {
+		rpcNotify(rpcplugin.Event{Type: rpcplugin.EventJoin, Player: cc.Name()})
+	})
+
+	RegisterOnAuth(func(cc *ClientConn) {
+		rpcNotify(rpcplugin.Event{Type: rpcplugin.EventAuth, Player: cc.Name()})
+	})
+
+	RegisterOnLeave(func(cc *ClientConn, lt LeaveType) {
+		rpcNotify(rpcplugin.Event{
+			Type:    rpcplugin.EventLeave,
+			Player:  cc.Name(),
+			Timeout: lt == Timeout,
+		})
+	})
+
+	RegisterOnPreAuth(func(cc *ClientConn) string {
+		return rpcDeny(rpcplugin.Event{Type: rpcplugin.EventPreAuth, Player: cc.Name()})
+	})
+
+	RegisterOnPostAuth(func(cc *ClientConn) string {
+		return rpcDeny(rpcplugin.Event{Type: rpcplugin.EventPostAuth, Player: cc.Name()})
+	})
+
+	RegisterOnHopStart(func(cc *ClientConn, from, to string) {
+		rpcNotify(rpcplugin.Event{
+			Type:   rpcplugin.EventHopStart,
+			Player: cc.Name(),
+			From:   from,
+			To:     to,
+		})
+	})
+
+	RegisterOnHopDone(func(cc *ClientConn, from, to string) {
+		rpcNotify(rpcplugin.Event{
+			Type:   rpcplugin.EventHopDone,
+			Player: cc.Name(),
+			From:   from,
+			To:     to,
+		})
+	})
+
+	RegisterOnHopFail(func(cc *ClientConn, from, to string, err error) {
+		rpcNotify(rpcplugin.Event{
+			Type:   rpcplugin.EventHopFail,
+			Player: cc.Name(),
+			From:   from,
+			To:     to,
+			Err:    errString(err),
+		})
+	})
+
+	RegisterOnSrvLost(func(cc *ClientConn, srv string, err error) {
+		rpcNotify(rpcplugin.Event{
+			Type:   rpcplugin.EventSrvLost,
+			Player: cc.Name(),
+			Server: srv,
+			Err:    errString(err),
+		})
+	})
+
+	RegisterInteractionHandler(InteractionHandler{
+		Type: AnyInteraction,
+		Handler: func(cc *ClientConn, cmd *mt.ToSrvInteract) bool {
+			ev := rpcplugin.Event{
+				Type:        rpcplugin.EventInteraction,
+				Player:      cc.Name(),
+				Interaction: uint8(cmd.Action),
+				ItemSlot:    cmd.ItemSlot,
+			}
+
+			switch pt := cmd.Pointed.(type) {
+			case *mt.PointedNode:
+				ev.PointedNode = &rpcplugin.PointedNode{
+					Under: pt.Under,
+					Above: pt.Above,
+				}
+			case *mt.PointedAO:
+				ev.PointedAO = uint16(pt.ID)
+			}
+
+			rpcConnsMu.RLock()
+			var conns []*rpcPluginConn
+			for pc := range rpcConns {
+				pc.mu.RLock()
+				_, any := pc.interactions[AnyInteraction]
+				_, ok := pc.interactions[Interaction(cmd.Action)]
+				pc.mu.RUnlock()
+
+				if any || ok {
+					conns = append(conns, pc)
+				}
+			}
+			rpcConnsMu.RUnlock()
+
+			handled := false
+			for _, pc := range conns {
+				reply, err := pc.call(ev)
+				if err != nil {
+					cc.Log("<-", "rpc plugin", pc.name, err)
+					continue
+				}
+
+				if reply.Handled {
+					handled = true
+				}
+			}
+
+			return handled
+		},
+	})
+}
+
+func registerRPCPluginCmd() {
+	// control returns a subcommand that applies an action to a plugin.
+	control := func(name, help string, action func(string) error) ChatCmd {
+		return ChatCmd{
+			Name: name,
+			Help: help,
+			Args: []ChatCmdArg{{Name: "name"}},
+			Handler: func(cc *ClientConn, args ...string) string {
+				if err := action(args[0]); err != nil {
+					return fmt.Sprintf("Could not %s %s. Error: %s", name, args[0], err)
+				}
+
+				return "Done."
+			},
+		}
+	}
+
+	RegisterChatCmd(ChatCmd{
+		Name: "rpcplugin",
+		Perm: "cmd_rpcplugin",
+		Help: "Manage out-of-process plugins.",
+		SubCmds: []ChatCmd{
+			{
+				Name: "list",
+				Help: "List the RPC plugins and whether they are running.",
+				Args: []ChatCmdArg{},
+				Handler: func(cc *ClientConn, args ...string) string {
+					plugins := RPCPlugins()
+					if len(plugins) == 0 {
+						return "No RPC plugins."
+					}
+
+					names := make([]string, 0, len(plugins))
+					for name := range plugins {
+						names = append(names, name)
+					}
+					sort.Strings(names)
+
+					var list []string
+					for _, name := range names {
+						if plugins[name] {
+							list = append(list, name+" (running)")
+						} else {
+							list = append(list, name+" (stopped)")
+						}
+					}
+
+					return "RPC plugins: " + strings.Join(list, ", ")
+				},
+			},
+			control("start", "Start an RPC plugin.", StartRPCPlugin),
+			control("stop", "Stop an RPC plugin.", StopRPCPlugin),
+			control("restart", "Restart an RPC plugin.", RestartRPCPlugin),
+		},
+	})
+}
@@ -0,0 +1,202 @@
+package rpcplugin
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrNoSocket = errors.New("proxy socket unknown: " + SocketEnv + " is not set")
+
+// A Client is a connection to the proxy from the point of view of a plugin.
+type Client struct {
+	rpc *rpc.Client
+
+	mu           sync.RWMutex
+	chatCmds     map[string]func(player string, args ...string) string
+	interactions map[uint8][]func(ev Event) bool
+	handlers     map[string][]func(ev Event) string
+}
+
+// Connect connects to the proxy that started the plugin.
+// It fails if the plugin wasn't started by the proxy.
+func Connect() (*Client, error) {
+	path := os.Getenv(SocketEnv)
+	if path == "" {
+		return nil, ErrNoSocket
+	}
+
+	return Dial(path, os.Getenv(NameEnv), os.Getenv(TokenEnv))
+}
+
+// Dial connects to the proxy socket at the specified path.
+// The name and token must be the ones the proxy
+// passed to the plugin when starting it.
+func Dial(path, name, token string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		rpc:          jsonrpc.NewClient(conn),
+		chatCmds:     make(map[string]func(string, ...string) string),
+		interactions: make(map[uint8][]func(Event) bool),
+		handlers:     make(map[string][]func(Event) string),
+	}
+
+	if err := c.call("Hello", HelloArgs{Name: name, Token: token}, &Empty{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the connection to the proxy.
+// All chat commands registered by the plugin are removed.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// RegisterChatCmd adds a new chat command handled by the plugin.
+func (c *Client) RegisterChatCmd(cmd ChatCmd, handler func(player string, args ...string) string) error {
+	if err := c.call("RegisterChatCmd", cmd, &Empty{}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chatCmds[cmd.Name] = handler
+	return nil
+}
+
+// RegisterInteractionHandler adds a new interaction handler.
+// It works like the proxy function of the same name.
+func (c *Client) RegisterInteractionHandler(typ uint8, handler func(ev Event) bool) error {
+	if err := c.call("RegisterInteractionHandler", InteractionArgs{Type: typ}, &Empty{}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions[typ] = append(c.interactions[typ], handler)
+	return nil
+}
+
+// Subscribe registers a handler for an event type.
+// The return value of the handler is only used for events
+// that expect a reply, e.g. to deny access.
+func (c *Client) Subscribe(event string, handler func(ev Event) string) error {
+	if err := c.call("Subscribe", SubscribeArgs{Events: []string{event}}, &Empty{}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers[event] = append(c.handlers[event], handler)
+	return nil
+}
+
+// Run receives and handles events until the connection is closed.
+// It always returns a non-nil error.
+func (c *Client) Run() error {
+	for {
+		var ev Event
+		if err := c.call("NextEvent", Empty{}, &ev); err != nil {
+			return err
+		}
+
+		go c.handle(ev)
+	}
+}
+
+func (c *Client) handle(ev Event) {
+	reply := Reply{ID: ev.ID}
+
+	c.mu.RLock()
+	chatCmd := c.chatCmds[ev.Cmd]
+	var interactions []func(Event) bool
+	interactions = append(interactions, c.interactions[255]...)
+	interactions = append(interactions, c.interactions[ev.Interaction]...)
+	handlers := c.handlers[ev.Type]
+	c.mu.RUnlock()
+
+	switch ev.Type {
+	case EventChatCmd:
+		if chatCmd != nil {
+			reply.Result = chatCmd(ev.Player, ev.Args...)
+		}
+	case EventInteraction:
+		for _, handler := range interactions {
+			if handler(ev) {
+				reply.Handled = true
+			}
+		}
+	default:
+		for _, handler := range handlers {
+			if result := handler(ev); result != "" && reply.Result == "" {
+				reply.Result = result
+			}
+		}
+	}
+
+	if ev.ID != 0 {
+		c.call("Reply", reply, &Empty{})
+	}
+}
+
+// Players returns the names of all players connected to the proxy.
+func (c *Client) Players() ([]string, error) {
+	var players []string
+	err := c.call("Players", Empty{}, &players)
+	return players, err
+}
+
+// ServerName returns the name of the current server of a player.
+func (c *Client) ServerName(player string) (string, error) {
+	var srv string
+	err := c.call("ServerName", PlayerArgs{Player: player}, &srv)
+	return srv, err
+}
+
+// SendChatMsg sends a chat message to a player.
+func (c *Client) SendChatMsg(player string, msg ...string) error {
+	return c.call("SendChatMsg", ChatMsgArgs{
+		Player: player,
+		Msg:    strings.Join(msg, " "),
+	}, &Empty{})
+}
+
+// Kick kicks a player with a custom reason.
+func (c *Client) Kick(player, reason string) error {
+	return c.call("Kick", KickArgs{Player: player, Reason: reason}, &Empty{})
+}
+
+// Hop moves a player to another server.
+func (c *Client) Hop(player, server string) error {
+	return c.call("Hop", HopArgs{Player: player, Server: server}, &Empty{})
+}
+
+// HopGroup moves a player to a server group.
+func (c *Client) HopGroup(player, group string) error {
+	return c.call("HopGroup", HopArgs{Player: player, Server: group}, &Empty{})
+}
+
+// HasPerms reports whether a player has all of the permissions.
+func (c *Client) HasPerms(player string, perms ...string) (bool, error) {
+	var has bool
+	err := c.call("HasPerms", PermsArgs{Player: player, Perms: perms}, &has)
+	return has, err
+}
+
+func (c *Client) call(method string, args, reply interface{}) error {
+	return c.rpc.Call(Service+"."+method, args, reply)
+}
@@ -0,0 +1,142 @@
+/*
+Package rpcplugin implements the out-of-process plugin protocol
+of mt-multiserver-proxy.
+
+RPC plugins are regular programs that communicate with the proxy
+using JSON-RPC 1.0 (as implemented by net/rpc/jsonrpc)
+over a Unix domain socket. The proxy provides a single service
+named Proxy. Plugins call its methods to register chat commands,
+interaction handlers and event subscriptions and to control players.
+Events are received by repeatedly calling Proxy.NextEvent.
+Events with a non-zero ID expect an answer via Proxy.Reply.
+
+The types in this file make up the protocol and can be used as a reference
+when implementing plugins in other languages. Go plugins can use the Client
+instead of speaking the protocol directly.
+*/
+package rpcplugin
+
+// Service is the name of the RPC service provided by the proxy.
+const Service = "Proxy"
+
+// Environment variables set by the proxy when it starts a plugin.
+const (
+	SocketEnv = "MT_PROXY_SOCKET"
+	NameEnv   = "MT_PROXY_PLUGIN"
+	TokenEnv  = "MT_PROXY_TOKEN"
+)
+
+// Event types. Events marked with a reply expect a call to Proxy.Reply.
+const (
+	EventChatCmd     = "chatcmd"     // reply: Result is sent to the player
+	EventInteraction = "interaction" // reply: Handled stops forwarding
+	EventPreAuth     = "preauth"     // reply: non-empty Result denies access
+	EventPostAuth    = "postauth"    // reply: non-empty Result denies access
+	EventJoin        = "join"
+	EventAuth        = "auth"
+	EventLeave       = "leave"
+	EventHopStart    = "hopstart"
+	EventHopDone     = "hopdone"
+	EventHopFail     = "hopfail"
+	EventSrvLost     = "srvlost"
+)
+
+// Empty is used for methods that don't take arguments
+// or don't return anything.
+type Empty struct{}
+
+// HelloArgs identifies a plugin. Proxy.Hello must be the first call
+// and may only be called once per connection.
+// The Token is passed in TokenEnv and changes every time
+// the plugin is started, so only plugins started by the proxy can connect.
+type HelloArgs struct {
+	Name  string
+	Token string
+}
+
+// A ChatCmd describes a chat command handled by the plugin.
+type ChatCmd struct {
+	Name    string
+	Aliases []string
+	Perm    string
+	Help    string
+	Usage   string
+}
+
+// InteractionArgs registers an interaction handler
+// for a specific interaction type or 255 for any interaction.
+type InteractionArgs struct {
+	Type uint8
+}
+
+// SubscribeArgs subscribes the plugin to the given event types.
+type SubscribeArgs struct {
+	Events []string
+}
+
+// A PointedNode is the node a player is pointing at.
+type PointedNode struct {
+	Under, Above [3]int16
+}
+
+// An Event is a notification sent from the proxy to the plugin.
+// Only the fields relevant to the event type are set.
+type Event struct {
+	ID     uint64
+	Type   string
+	Player string
+
+	// EventChatCmd
+	Cmd  string
+	Args []string
+
+	// EventInteraction
+	Interaction uint8
+	ItemSlot    uint16
+	PointedNode *PointedNode
+	PointedAO   uint16
+
+	// EventHopStart, EventHopDone, EventHopFail, EventSrvLost
+	From, To string
+	Server   string
+	Err      string
+
+	// EventLeave
+	Timeout bool
+}
+
+// A Reply answers an Event that has a non-zero ID.
+type Reply struct {
+	ID      uint64
+	Result  string
+	Handled bool
+}
+
+// PlayerArgs refers to a connected player.
+type PlayerArgs struct {
+	Player string
+}
+
+// ChatMsgArgs sends a chat message to a player.
+type ChatMsgArgs struct {
+	Player string
+	Msg    string
+}
+
+// KickArgs kicks a player with a custom reason.
+type KickArgs struct {
+	Player string
+	Reason string
+}
+
+// HopArgs moves a player to a server or server group.
+type HopArgs struct {
+	Player string
+	Server string
+}
+
+// PermsArgs checks whether a player has all of the permissions.
+type PermsArgs struct {
+	Player string
+	Perms  []string
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+
+	"github.com/HimbeerserverDE/mt-multiserver-proxy/rpcplugin"
+)
+
+var (
+	ErrRPCPluginHello      = errors.New("RPC plugin must identify itself first")
+	ErrRPCPluginExists     = errors.New("RPC plugin with the same name already connected")
+	ErrRPCPluginToken      = errors.New("invalid RPC plugin token")
+	ErrRPCPluginHelloTwice = errors.New("RPC plugin has already identified itself")
+	ErrChatCmdExists       = errors.New("chat command already exists")
+	ErrNoSuchPlayer        = errors.New("player not connected")
+	ErrUnknownRPCEvent     = errors.New("unknown RPC plugin event type")
+	ErrUnexpectedRPCReply  = errors.New("no event is waiting for this reply")
+)
+
+// rpcPluginService implements the methods RPC plugins can call.
+// The protocol is documented in the rpcplugin package.
+type rpcPluginService struct {
+	pc *rpcPluginConn
+}
+
+// Hello binds the name of the plugin to the connection.
+// Only the process the proxy started under this name
+// knows the token that is required to do so.
+func (s *rpcPluginService) Hello(args rpcplugin.HelloArgs, _ *rpcplugin.Empty) error {
+	if !validRPCPluginToken(args.Name, args.Token) {
+		return ErrRPCPluginToken
+	}
+
+	// The name is only ever set here with rpcConnsMu held,
+	// so concurrent calls can't both succeed.
+	rpcConnsMu.Lock()
+	defer rpcConnsMu.Unlock()
+
+	if s.hello() == nil {
+		return ErrRPCPluginHelloTwice
+	}
+
+	for pc := range rpcConns {
+		if pc.name == args.Name {
+			return ErrRPCPluginExists
+		}
+	}
+
+	s.pc.mu.Lock()
+	s.pc.name = args.Name
+	s.pc.mu.Unlock()
+
+	rpcConns[s.pc] = struct{}{}
+
+	log.Print("rpc plugin ", args.Name, " connected")
+	return nil
+}
+
+func (s *rpcPluginService) RegisterChatCmd(args rpcplugin.ChatCmd, _ *rpcplugin.Empty) error {
+	if err := s.hello(); err != nil {
+		return err
+	}
+
+	pc := s.pc
+	ok := RegisterChatCmd(ChatCmd{
+		Name:    args.Name,
+		Aliases: args.Aliases,
+		Perm:    args.Perm,
+		Help:    args.Help,
+		Usage:   args.Usage,
+		Handler: func(cc *ClientConn, cmdArgs ...string) string {
+			reply, err := pc.call(rpcplugin.Event{
+				Type:   rpcplugin.EventChatCmd,
+				Player: cc.Name(),
+				Cmd:    args.Name,
+				Args:   cmdArgs,
+			})
+			if err != nil {
+				cc.Log("<-", "rpc plugin", pc.name, err)
+				return "Plugin error: " + err.Error()
+			}
+
+			return reply.Result
+		},
+	})
+	if !ok {
+		return ErrChatCmdExists
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.chatCmds = append(pc.chatCmds, args.Name)
+	return nil
+}
+
+func (s *rpcPluginService) RegisterInteractionHandler(args rpcplugin.InteractionArgs, _ *rpcplugin.Empty) error {
+	if err := s.hello(); err != nil {
+		return err
+	}
+
+	s.pc.mu.Lock()
+	defer s.pc.mu.Unlock()
+
+	s.pc.interactions[Interaction(args.Type)] = struct{}{}
+	return nil
+}
+
+func (s *rpcPluginService) Subscribe(args rpcplugin.SubscribeArgs, _ *rpcplugin.Empty) error {
+	if err := s.hello(); err != nil {
+		return err
+	}
+
+	for _, event := range args.Events {
+		switch event {
+		case rpcplugin.EventPreAuth, rpcplugin.EventPostAuth, rpcplugin.EventJoin, rpcplugin.EventAuth, rpcplugin.EventLeave, rpcplugin.EventHopStart, rpcplugin.EventHopDone, rpcplugin.EventHopFail, rpcplugin.EventSrvLost:
+		default:
+			return ErrUnknownRPCEvent
+		}
+	}
+
+	s.pc.mu.Lock()
+	defer s.pc.mu.Unlock()
+
+	for _, event := range args.Events {
+		s.pc.subs[event] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s *rpcPluginService) NextEvent(_ rpcplugin.Empty, ev *rpcplugin.Event) error {
+	if err := s.hello(); err != nil {
+		return err
+	}
+
+	select {
+	case *ev = <-s.pc.events:
+		return nil
+	case <-s.pc.closed:
+		return ErrRPCPluginClosed
+	}
+}
+
+func (s *rpcPluginService) Reply(args rpcplugin.Reply, _ *rpcplugin.Empty) error {
+	s.pc.mu.RLock()
+	ch, ok := s.pc.pending[args.ID]
+	s.pc.mu.RUnlock()
+
+	if !ok {
+		return ErrUnexpectedRPCReply
+	}
+
+	select {
+	case ch <- args:
+	default:
+	}
+
+	return nil
+}
+
+func (s *rpcPluginService) Players(_ rpcplugin.Empty, players *[]string) error {
+	*players = make([]string, 0)
+	for player := range Players() {
+		*players = append(*players, player)
+	}
+
+	return nil
+}
+
+func (s *rpcPluginService) ServerName(args rpcplugin.PlayerArgs, srv *string) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	*srv = cc.ServerName()
+	return nil
+}
+
+func (s *rpcPluginService) SendChatMsg(args rpcplugin.ChatMsgArgs, _ *rpcplugin.Empty) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	cc.SendChatMsg(args.Msg)
+	return nil
+}
+
+func (s *rpcPluginService) Kick(args rpcplugin.KickArgs, _ *rpcplugin.Empty) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	cc.Kick(args.Reason)
+	return nil
+}
+
+func (s *rpcPluginService) Hop(args rpcplugin.HopArgs, _ *rpcplugin.Empty) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	return cc.Hop(args.Server)
+}
+
+func (s *rpcPluginService) HopGroup(args rpcplugin.HopArgs, _ *rpcplugin.Empty) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	return cc.HopGroup(args.Server)
+}
+
+func (s *rpcPluginService) HasPerms(args rpcplugin.PermsArgs, has *bool) error {
+	cc := Find(args.Player)
+	if cc == nil {
+		return ErrNoSuchPlayer
+	}
+
+	*has = cc.HasPerms(args.Perms...)
+	return nil
+}
+
+func (s *rpcPluginService) hello() error {
+	s.pc.mu.RLock()
+	defer s.pc.mu.RUnlock()
+
+	if s.pc.name == "" {
+		return ErrRPCPluginHello
+	}
+
+	return nil
+}
@@ -23,6 +23,17 @@ func runFunc() {
 		loadPlugins()
 	}
 
+	if !Conf().NoRPCPlugins {
+		loadRPCPlugins()
+	}
+
+	if !Conf().NoScripts {
+		loadScripts()
+	}
+
+	// After plugins and scripts so that their commands take precedence.
+	loadAdminCmds()
+
 	var err error
 	switch Conf().AuthBackend {
 	case "files":
@@ -60,6 +71,12 @@ func runFunc() {
 
 	log.Println("listen", l.Addr())
 
+	if Conf().MediaServer.Enable {
+		go serveMedia()
+	}
+
+	go flushCacheIndex()
+
 	go func() {
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
@@ -92,6 +109,12 @@ func runFunc() {
 		}
 
 		wg.Wait()
+		stopRPCPlugins()
+
+		if err := SaveCacheIndex(); err != nil {
+			log.Print(err)
+		}
+
 		os.Exit(0)
 	}()
 
@@ -111,6 +134,8 @@ func runFunc() {
 			<-cc.Init()
 			cc.Log("<->", "handshake completed")
 
+			handleJoin(cc)
+
 			conf := Conf()
 			if len(conf.Servers) == 0 {
 				cc.Log("<-", "no servers")
@@ -0,0 +1,499 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HimbeerserverDE/mt"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ScriptReloadInterval is the interval at which the `scripts` directory
+// is checked for new, modified or deleted scripts.
+var ScriptReloadInterval = 2 * time.Second
+
+type script struct {
+	name    string
+	modTime time.Time
+
+	mu     sync.Mutex
+	l      *lua.LState
+	closed bool
+
+	chatCmds     []string
+	interactions []struct {
+		typ Interaction
+		fn  *lua.LFunction
+	}
+}
+
+var scripts = make(map[string]*script)
+var scriptsMu sync.RWMutex
+var scriptsOnce sync.Once
+
+func loadScripts() {
+	scriptsOnce.Do(func() {
+		os.Mkdir(Path("scripts"), 0777)
+
+		RegisterInteractionHandler(InteractionHandler{
+			Type:    AnyInteraction,
+			Handler: handleScriptInteraction,
+		})
+
+		reloadScripts()
+		log.Print("load scripts")
+
+		go func() {
+			for {
+				time.Sleep(ScriptReloadInterval)
+				reloadScripts()
+			}
+		}()
+	})
+}
+
+// reloadScripts (re)loads all new and modified scripts
+// and unloads deleted ones.
+func reloadScripts() {
+	dir, err := os.ReadDir(Path("scripts"))
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	found := make(map[string]time.Time)
+	for _, f := range dir {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".lua") {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		found[f.Name()] = info.ModTime()
+	}
+
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	for name, s := range scripts {
+		if modTime, ok := found[name]; !ok || !modTime.Equal(s.modTime) {
+			s.unload()
+			delete(scripts, name)
+
+			log.Print("unload script ", name)
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := scripts[name]; ok {
+			continue
+		}
+
+		s := &script{
+			name:    name,
+			modTime: found[name],
+		}
+		scripts[name] = s
+
+		if err := s.load(); err != nil {
+			log.Print("script ", name, ": ", err)
+			continue
+		}
+
+		log.Print("load script ", name)
+	}
+}
+
+func (s *script) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.l = lua.NewState()
+	s.l.SetGlobal("proxy", s.api())
+
+	return s.l.DoFile(Path("scripts/", s.name))
+}
+
+func (s *script) unload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range s.chatCmds {
+		UnregisterChatCmd(name)
+	}
+
+	s.closed = true
+	s.l.Close()
+}
+
+func (s *script) api() *lua.LTable {
+	api := s.l.NewTable()
+
+	s.l.SetFuncs(api, map[string]lua.LGFunction{
+		"register_chatcmd":             s.luaRegisterChatCmd,
+		"register_interaction_handler": s.luaRegisterInteractionHandler,
+		"players":                      luaPlayers,
+		"find":                         luaFind,
+		"server_name":                  luaServerName,
+		"has_perms":                    luaHasPerms,
+		"send_chat_msg":                luaSendChatMsg,
+		"kick":                         luaKick,
+		"hop":                          luaHop,
+		"hop_group":                    luaHopGroup,
+		"conf":                         luaConf,
+		"log":                          s.luaLog,
+	})
+
+	return api
+}
+
+// call runs a Lua function with the script lock held.
+// It returns the first return value or nil if the script
+// has been unloaded or raised an error.
+func (s *script) call(fn *lua.LFunction, args ...lua.LValue) lua.LValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return lua.LNil
+	}
+
+	return s.callLocked(fn, args...)
+}
+
+// callInteraction runs an interaction handler with the script lock held.
+// The table describing the interaction is created on the state
+// of the script, so it must not be built before the lock is taken.
+func (s *script) callInteraction(fn *lua.LFunction, cc *ClientConn, cmd *mt.ToSrvInteract) lua.LValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return lua.LNil
+	}
+
+	return s.callLocked(fn, lua.LString(cc.Name()), luaInteraction(s.l, cmd))
+}
+
+// callLocked runs a Lua function. The caller must hold the script lock
+// and make sure that the script hasn't been unloaded.
+func (s *script) callLocked(fn *lua.LFunction, args ...lua.LValue) lua.LValue {
+	if err := s.l.CallByParam(lua.P{
+		Fn:      fn,
+		NRet:    1,
+		Protect: true,
+	}, args...); err != nil {
+		log.Print("script ", s.name, ": ", err)
+		return lua.LNil
+	}
+
+	ret := s.l.Get(-1)
+	s.l.Pop(1)
+
+	return ret
+}
+
+func (s *script) luaRegisterChatCmd(l *lua.LState) int {
+	def := l.CheckTable(1)
+
+	name := lua.LVAsString(def.RawGetString("name"))
+	fn, ok := def.RawGetString("handler").(*lua.LFunction)
+	if name == "" || !ok {
+		l.ArgError(1, "name and handler are required")
+		return 0
+	}
+
+	var aliases []string
+	if t, ok := def.RawGetString("aliases").(*lua.LTable); ok {
+		t.ForEach(func(_, v lua.LValue) {
+			aliases = append(aliases, lua.LVAsString(v))
+		})
+	}
+
+	cmd := ChatCmd{
+		Name:     name,
+		Aliases:  aliases,
+		Perm:     lua.LVAsString(def.RawGetString("perm")),
+		Help:     lua.LVAsString(def.RawGetString("help")),
+		Usage:    lua.LVAsString(def.RawGetString("usage")),
+		Cooldown: time.Duration(float64(lua.LVAsNumber(def.RawGetString("cooldown"))) * float64(time.Second)),
+		Handler: func(cc *ClientConn, args ...string) string {
+			largs := []lua.LValue{lua.LString(cc.Name())}
+			for _, arg := range args {
+				largs = append(largs, lua.LString(arg))
+			}
+
+			if ret, ok := s.call(fn, largs...).(lua.LString); ok {
+				return string(ret)
+			}
+
+			return ""
+		},
+	}
+
+	if !RegisterChatCmd(cmd) {
+		l.Push(lua.LFalse)
+		return 1
+	}
+
+	s.chatCmds = append(s.chatCmds, name)
+
+	l.Push(lua.LTrue)
+	return 1
+}
+
+func (s *script) luaRegisterInteractionHandler(l *lua.LState) int {
+	typ := Interaction(l.CheckInt(1))
+	fn := l.CheckFunction(2)
+
+	s.interactions = append(s.interactions, struct {
+		typ Interaction
+		fn  *lua.LFunction
+	}{typ, fn})
+
+	return 0
+}
+
+func (s *script) luaLog(l *lua.LState) int {
+	var v []string
+	for i := 1; i <= l.GetTop(); i++ {
+		v = append(v, l.ToStringMeta(l.Get(i)).String())
+	}
+
+	log.Print("[script ", s.name, "] ", strings.Join(v, " "))
+	return 0
+}
+
+func handleScriptInteraction(cc *ClientConn, cmd *mt.ToSrvInteract) bool {
+	scriptsMu.RLock()
+	defer scriptsMu.RUnlock()
+
+	handled := false
+	for _, s := range scripts {
+		s.mu.Lock()
+		var fns []*lua.LFunction
+		for _, h := range s.interactions {
+			if h.typ == AnyInteraction || h.typ == Interaction(cmd.Action) {
+				fns = append(fns, h.fn)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, fn := range fns {
+			if lua.LVAsBool(s.callInteraction(fn, cc, cmd)) {
+				handled = true
+			}
+		}
+	}
+
+	return handled
+}
+
+func luaInteraction(l *lua.LState, cmd *mt.ToSrvInteract) *lua.LTable {
+	t := l.NewTable()
+	t.RawSetString("action", lua.LNumber(cmd.Action))
+	t.RawSetString("item_slot", lua.LNumber(cmd.ItemSlot))
+
+	switch pt := cmd.Pointed.(type) {
+	case *mt.PointedNode:
+		t.RawSetString("under", luaPos(l, pt.Under))
+		t.RawSetString("above", luaPos(l, pt.Above))
+	case *mt.PointedAO:
+		t.RawSetString("ao", lua.LNumber(pt.ID))
+	}
+
+	return t
+}
+
+func luaPos(l *lua.LState, pos [3]int16) *lua.LTable {
+	t := l.NewTable()
+	t.RawSetString("x", lua.LNumber(pos[0]))
+	t.RawSetString("y", lua.LNumber(pos[1]))
+	t.RawSetString("z", lua.LNumber(pos[2]))
+
+	return t
+}
+
+// luaClt returns the ClientConn named by the first argument.
+// If it isn't connected it pushes nil and an error message.
+func luaClt(l *lua.LState) (*ClientConn, int) {
+	cc := Find(l.CheckString(1))
+	if cc == nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(ErrNoSuchPlayer.Error()))
+		return nil, 2
+	}
+
+	return cc, 0
+}
+
+// luaResult pushes true or nil and an error message.
+func luaResult(l *lua.LState, err error) int {
+	if err != nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	l.Push(lua.LTrue)
+	return 1
+}
+
+func luaPlayers(l *lua.LState) int {
+	var names []string
+	for name := range Players() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := l.NewTable()
+	for _, name := range names {
+		t.Append(lua.LString(name))
+	}
+
+	l.Push(t)
+	return 1
+}
+
+func luaFind(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	t := l.NewTable()
+	t.RawSetString("name", lua.LString(cc.Name()))
+	t.RawSetString("server", lua.LString(cc.ServerName()))
+	t.RawSetString("addr", lua.LString(cc.RemoteAddr().String()))
+
+	l.Push(t)
+	return 1
+}
+
+func luaServerName(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	l.Push(lua.LString(cc.ServerName()))
+	return 1
+}
+
+func luaHasPerms(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	var perms []string
+	for i := 2; i <= l.GetTop(); i++ {
+		perms = append(perms, l.CheckString(i))
+	}
+
+	l.Push(lua.LBool(cc.HasPerms(perms...)))
+	return 1
+}
+
+func luaSendChatMsg(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	var msg []string
+	for i := 2; i <= l.GetTop(); i++ {
+		msg = append(msg, l.ToStringMeta(l.Get(i)).String())
+	}
+
+	cc.SendChatMsg(msg...)
+	return luaResult(l, nil)
+}
+
+func luaKick(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	cc.Kick(l.OptString(2, "Kicked by proxy."))
+	return luaResult(l, nil)
+}
+
+func luaHop(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	return luaResult(l, cc.Hop(l.CheckString(2)))
+}
+
+func luaHopGroup(l *lua.LState) int {
+	cc, n := luaClt(l)
+	if cc == nil {
+		return n
+	}
+
+	return luaResult(l, cc.HopGroup(l.CheckString(2)))
+}
+
+// luaConf returns a read-only copy of the Config as a Lua table.
+func luaConf(l *lua.LState) int {
+	b, err := json.Marshal(Conf())
+	if err != nil {
+		return luaResult(l, err)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return luaResult(l, err)
+	}
+
+	l.Push(luaValue(l, v))
+	return 1
+}
+
+func luaValue(l *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := l.NewTable()
+		for _, elem := range v {
+			t.Append(luaValue(l, elem))
+		}
+
+		return t
+	case map[string]interface{}:
+		t := l.NewTable()
+		for k, elem := range v {
+			t.RawSetString(k, luaValue(l, elem))
+		}
+
+		return t
+	}
+
+	return lua.LString(fmt.Sprint(v))
+}
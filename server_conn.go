@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"errors"
+	"hash"
 	"log"
 	"net"
 	"sync"
@@ -29,14 +30,15 @@ type ServerConn struct {
 		salt, srpA, a, srpK []byte
 	}
 
-	mediaPool string
-	dynMedia  map[string]struct {
-		token uint32
-		cache bool
-	}
+	mediaPool    string
+	contentHash  hash.Hash
+	dynMediaReqs map[string]dynMediaReq
 
 	inv          mt.Inv
 	detachedInvs []string
+	// handoffInv is a copy of inv that is safe to read
+	// from other goroutines while mu is held.
+	handoffInv mt.Inv
 
 	aos              map[mt.AOID]struct{}
 	particleSpawners map[mt.ParticleSpawnerID]struct{}
@@ -46,6 +48,10 @@ type ServerConn struct {
 	huds map[mt.HUDID]mt.HUDType
 
 	playerList map[string]struct{}
+
+	hp, breath *uint16
+
+	ctlJoined bool
 }
 
 func (sc *ServerConn) client() *ClientConn {
@@ -116,6 +122,8 @@ RecvLoop:
 				}
 
 				if sc.client() != nil {
+					handleSrvLost(sc.client(), sc.name, sc.WhyClosed())
+
 					if errors.Is(sc.WhyClosed(), rudp.ErrTimedOut) {
 						sc.client().SendChatMsg("Server connection timed out, triggering fallback.")
 					} else {
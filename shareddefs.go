@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// A SharedDefConflict is a node or item of a shared mod
+// whose definition differs between media pools.
+// The pools in Shared use a single definition without a prefix.
+// The pools in Divergent keep their own prefixed definition.
+type SharedDefConflict struct {
+	Name      string
+	Shared    []string
+	Divergent []string
+}
+
+var (
+	sharedConflicts   []SharedDefConflict
+	sharedConflictsMu sync.RWMutex
+)
+
+// SharedDefConflicts returns the definitions of shared mods
+// that differ between media pools as of the last time
+// the content was fetched.
+// Shared mods are configured using the `MediaPools` config option.
+func SharedDefConflicts() []SharedDefConflict {
+	sharedConflictsMu.RLock()
+	defer sharedConflictsMu.RUnlock()
+
+	return slices.Clone(sharedConflicts)
+}
+
+// isShared reports whether a name is defined
+// by a shared mod of a media pool and identical to the definitions
+// of the other pools sharing it.
+func (n *contentNames) isShared(pool, name string) bool {
+	if n == nil {
+		return false
+	}
+
+	_, ok := n.sharedNames[pool][name]
+	return ok
+}
+
+// defFingerprint returns a string that is equal for two servers
+// if they define the node or item in the same way.
+// Content IDs are replaced with node names
+// because they differ between servers.
+func defFingerprint(itemDef *mt.ItemDef, nodeDef *mt.NodeDef, names map[mt.Content]string) string {
+	b := &strings.Builder{}
+
+	if itemDef != nil {
+		fmt.Fprintf(b, "%v", *itemDef)
+	}
+
+	b.WriteString("|")
+
+	if nodeDef != nil {
+		def := *nodeDef
+		def.Param0 = 0
+
+		connectTo := make([]string, len(def.ConnectTo))
+		for i, p0 := range def.ConnectTo {
+			connectTo[i] = names[p0]
+		}
+		def.ConnectTo = nil
+
+		fmt.Fprintf(b, "%v|%v", def, connectTo)
+	}
+
+	return b.String()
+}
+
+// muxShared determines which definitions of shared mods
+// can be merged and returns them for each media pool.
+// The first pool to define a name decides what it looks like.
+func muxShared(conns []*contentConn) map[string]map[string]struct{} {
+	conf := Conf()
+
+	type sharedDef struct {
+		fingerprint string
+		shared      []string
+		divergent   []string
+	}
+
+	defs := make(map[string]*sharedDef)
+	var order []string
+
+	shared := make(map[string]map[string]struct{})
+	for _, cc := range conns {
+		<-cc.done()
+
+		mods := conf.MediaPools[cc.mediaPool].SharedMods
+		if len(mods) == 0 {
+			continue
+		}
+
+		isShared := func(name string) bool {
+			mod, _, ok := strings.Cut(name, ":")
+			return ok && slices.Contains(mods, mod)
+		}
+
+		names := make(map[mt.Content]string)
+		nodeDefs := make(map[string]*mt.NodeDef)
+		for i, def := range cc.nodeDefs {
+			names[def.Param0] = def.Name
+			nodeDefs[def.Name] = &cc.nodeDefs[i]
+		}
+
+		itemDefs := make(map[string]*mt.ItemDef)
+		for i, def := range cc.itemDefs {
+			itemDefs[def.Name] = &cc.itemDefs[i]
+		}
+
+		fingerprints := make(map[string]string)
+		for name, def := range itemDefs {
+			if isShared(name) {
+				fingerprints[name] = defFingerprint(def, nodeDefs[name], names)
+			}
+		}
+		for name, def := range nodeDefs {
+			if _, ok := itemDefs[name]; !ok && isShared(name) {
+				fingerprints[name] = defFingerprint(nil, def, names)
+			}
+		}
+
+		shared[cc.mediaPool] = make(map[string]struct{})
+		for name, fp := range fingerprints {
+			def, ok := defs[name]
+			if !ok {
+				def = &sharedDef{fingerprint: fp}
+				defs[name] = def
+				order = append(order, name)
+			}
+
+			if def.fingerprint != fp {
+				def.divergent = append(def.divergent, cc.mediaPool)
+				continue
+			}
+
+			def.shared = append(def.shared, cc.mediaPool)
+			shared[cc.mediaPool][name] = struct{}{}
+		}
+	}
+
+	sort.Strings(order)
+
+	var conflicts []SharedDefConflict
+	for _, name := range order {
+		def := defs[name]
+		if len(def.divergent) == 0 {
+			continue
+		}
+
+		log.Printf("shared definition %s differs between media pools, shared by %v, divergent in %v", name, def.shared, def.divergent)
+
+		conflicts = append(conflicts, SharedDefConflict{
+			Name:      name,
+			Shared:    def.shared,
+			Divergent: def.divergent,
+		})
+	}
+
+	sharedConflictsMu.Lock()
+	defer sharedConflictsMu.Unlock()
+
+	sharedConflicts = conflicts
+	return shared
+}
@@ -0,0 +1,54 @@
+package proxy
+
+// A Storage is a namespaced key/value store for plugins.
+// It is backed by the configured authentication backend
+// and is therefore converted along with it by mt-auth-convert.
+// The zero value is invalid, use NewStorage instead.
+type Storage struct {
+	namespace string
+	player    string
+}
+
+// NewStorage returns the global scope of the storage namespace.
+// Plugins should use their name as the namespace
+// to avoid conflicts with other plugins.
+func NewStorage(namespace string) Storage {
+	return Storage{namespace: namespace}
+}
+
+// Player returns the scope of the storage namespace
+// that belongs to the specified player.
+func (s Storage) Player(name string) Storage {
+	return Storage{
+		namespace: s.namespace,
+		player:    name,
+	}
+}
+
+// Namespace returns the namespace of the Storage.
+func (s Storage) Namespace() string { return s.namespace }
+
+// PlayerName returns the name of the player the Storage belongs to.
+// It is empty for the global scope.
+func (s Storage) PlayerName() string { return s.player }
+
+// Get returns the value of a key.
+// If the key doesn't exist ErrNoStorageKey is returned.
+func (s Storage) Get(key string) (string, error) {
+	return authIface.StorageGet(s.namespace, s.player, key)
+}
+
+// Set sets the value of a key, creating it if necessary.
+func (s Storage) Set(key, value string) error {
+	return authIface.StorageSet(s.namespace, s.player, key, value)
+}
+
+// Rm deletes a key. It is not an error if the key doesn't exist.
+func (s Storage) Rm(key string) error {
+	return authIface.StorageRm(s.namespace, s.player, key)
+}
+
+// Keys returns all keys in the scope of the Storage.
+func (s Storage) Keys() ([]string, error) {
+	return authIface.StorageKeys(s.namespace, s.player)
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import "strings"
+
+// rewriteTexture replaces every media file referenced
+// by a texture string with the result of f.
+// It understands the texture modifier language including
+// grouping, escaping and the modifiers that embed other textures
+// ([combine, [inventorycube, [lowpart and [mask).
+// Modifiers that don't reference files (e.g. [png) are left untouched.
+func rewriteTexture(t string, f func(file string) string) string {
+	parts := splitTexture(t, '^')
+	for i, part := range parts {
+		parts[i] = rewriteTexturePart(part, f)
+	}
+
+	return strings.Join(parts, "^")
+}
+
+func rewriteTexturePart(part string, f func(string) string) string {
+	switch {
+	case part == "":
+		return part
+	case part[0] == '(' && strings.HasSuffix(part, ")"):
+		return "(" + rewriteTexture(part[1:len(part)-1], f) + ")"
+	case part[0] == '[':
+		return rewriteTextureMod(part, f)
+	default:
+		return f(part)
+	}
+}
+
+func rewriteTextureMod(mod string, f func(string) string) string {
+	// rewriteEscaped rewrites a texture that has been escaped
+	// to be embedded in a modifier.
+	rewriteEscaped := func(t string) string {
+		raw := textureUnescape(t)
+		rewritten := rewriteTexture(raw, f)
+		if rewritten == raw {
+			return t
+		}
+
+		return textureEscape(rewritten, "\\^:")
+	}
+
+	switch {
+	case strings.HasPrefix(mod, "[combine:"):
+		args := splitTexture(mod[len("[combine:"):], ':')
+
+		// The first argument is the size.
+		for i := 1; i < len(args); i++ {
+			pos, t, ok := strings.Cut(args[i], "=")
+			if !ok {
+				continue
+			}
+
+			args[i] = pos + "=" + rewriteEscaped(t)
+		}
+
+		return "[combine:" + strings.Join(args, ":")
+	case strings.HasPrefix(mod, "[inventorycube{"):
+		faces := strings.Split(mod[len("[inventorycube{"):], "{")
+		for i, face := range faces {
+			// Faces use & instead of ^.
+			t := strings.ReplaceAll(face, "&", "^")
+			faces[i] = strings.ReplaceAll(rewriteTexture(t, f), "^", "&")
+		}
+
+		return "[inventorycube{" + strings.Join(faces, "{")
+	case strings.HasPrefix(mod, "[lowpart:"):
+		percent, t, ok := strings.Cut(mod[len("[lowpart:"):], ":")
+		if !ok {
+			return mod
+		}
+
+		return "[lowpart:" + percent + ":" + rewriteEscaped(t)
+	case strings.HasPrefix(mod, "[mask:"):
+		return "[mask:" + rewriteEscaped(mod[len("[mask:"):])
+	}
+
+	return mod
+}
+
+// splitTexture splits a texture string at every occurence of sep
+// that isn't escaped or enclosed in parentheses.
+func splitTexture(t string, sep byte) []string {
+	var parts []string
+	var depth int
+
+	start := 0
+	for i := 0; i < len(t); i++ {
+		switch t[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, t[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, t[start:])
+}
+
+// textureUnescape removes one level of backslash escaping.
+func textureUnescape(t string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(t); i++ {
+		if t[i] == '\\' && i+1 < len(t) {
+			i++
+		}
+
+		b.WriteByte(t[i])
+	}
+
+	return b.String()
+}
+
+// textureEscape escapes the specified characters using backslashes.
+func textureEscape(t, chars string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(t); i++ {
+		if strings.IndexByte(chars, t[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(t[i])
+	}
+
+	return b.String()
+}
+
+// textureFiles returns the names of the media files
+// referenced by a texture string.
+func textureFiles(t string) []string {
+	var files []string
+	rewriteTexture(t, func(file string) string {
+		if strings.Contains(file, ".") {
+			files = append(files, file)
+		}
+
+		return file
+	})
+
+	return files
+}
+
+// prependTextureString prefixes all media files referenced
+// by a texture string according to the naming settings of a media pool.
+func prependTextureString(p prefixer, t string) string {
+	return rewriteTexture(t, func(file string) string {
+		if !strings.Contains(file, ".") {
+			return file
+		}
+
+		return p.name(file)
+	})
+}
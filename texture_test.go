@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRewriteTexture(t *testing.T) {
+	prefix := func(file string) string {
+		return "p_" + file
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"a.png", "p_a.png"},
+		{"a.png^b.png", "p_a.png^p_b.png"},
+		{"a.png^[colorize:#ff0000:128", "p_a.png^[colorize:#ff0000:128"},
+		{"a.png^[png:iVBORw0KGgo=", "p_a.png^[png:iVBORw0KGgo="},
+		{"(a.png^b.png)^c.png", "(p_a.png^p_b.png)^p_c.png"},
+		{"((a.png^b.png)^c.png)^d.png", "((p_a.png^p_b.png)^p_c.png)^p_d.png"},
+		{"[combine:16x16:0,0=a.png:8,0=b.png", "[combine:16x16:0,0=p_a.png:8,0=p_b.png"},
+		{`[combine:16x16:0,0=a.png\^[colorize\:red`, `[combine:16x16:0,0=p_a.png\^[colorize\:red`},
+		{`[combine:16x16:0,0=b.png\^[mask\:m.png`, `[combine:16x16:0,0=p_b.png\^[mask\:p_m.png`},
+		{`[combine:16x16:0,0=[lowpart\:50\:a.png`, `[combine:16x16:0,0=[lowpart\:50\:p_a.png`},
+		{"[combine:16x16:0,0=(a.png^b.png)", `[combine:16x16:0,0=(p_a.png\^p_b.png)`},
+		{"[combine:16x16", "[combine:16x16"},
+		{"[combine:16x16:0,0", "[combine:16x16:0,0"},
+		{"[inventorycube{a.png{b.png{c.png", "[inventorycube{p_a.png{p_b.png{p_c.png"},
+		{"[inventorycube{a.png&b.png{c.png&[colorize:red{d.png", "[inventorycube{p_a.png&p_b.png{p_c.png&[colorize:red{p_d.png"},
+		{"[lowpart:50:a.png", "[lowpart:50:p_a.png"},
+		{`[lowpart:50:a.png\^b.png`, `[lowpart:50:p_a.png\^p_b.png`},
+		{"[lowpart:50", "[lowpart:50"},
+		{"a.png^[mask:m.png", "p_a.png^[mask:p_m.png"},
+		{`a.png^[mask:m.png\^[invert\:rgb`, `p_a.png^[mask:p_m.png\^[invert\:rgb`},
+		{"a.png^", "p_a.png^"},
+		{"^^", "^^"},
+	}
+
+	for _, tt := range tests {
+		if got := rewriteTexture(tt.in, prefix); got != tt.want {
+			t.Errorf("rewriteTexture(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTexture(t *testing.T) {
+	tests := []struct {
+		in   string
+		sep  byte
+		want []string
+	}{
+		{"", '^', []string{""}},
+		{"a^b", '^', []string{"a", "b"}},
+		{"a^", '^', []string{"a", ""}},
+		{`a\^b^c`, '^', []string{`a\^b`, "c"}},
+		{`a\\^b`, '^', []string{`a\\`, "b"}},
+		{"(a^b)^c", '^', []string{"(a^b)", "c"}},
+		{"((a^b)^c)^d", '^', []string{"((a^b)^c)", "d"}},
+		{"a)^b", '^', []string{"a)", "b"}},
+		{"(a^b", '^', []string{"(a^b"}},
+		{"16x16:0,0=a:1,1=b", ':', []string{"16x16", "0,0=a", "1,1=b"}},
+		{`16x16:0,0=a\:b`, ':', []string{"16x16", `0,0=a\:b`}},
+		{`a\`, '^', []string{`a\`}},
+	}
+
+	for _, tt := range tests {
+		if got := splitTexture(tt.in, tt.sep); !slices.Equal(got, tt.want) {
+			t.Errorf("splitTexture(%q, %q) = %q, want %q", tt.in, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestTextureEscape(t *testing.T) {
+	tests := []struct {
+		raw, escaped string
+	}{
+		{"", ""},
+		{"a.png", "a.png"},
+		{"a.png^[colorize:red", `a.png\^[colorize\:red`},
+		{`a\b`, `a\\b`},
+		{`a\^b`, `a\\\^b`},
+	}
+
+	for _, tt := range tests {
+		if got := textureEscape(tt.raw, "\\^:"); got != tt.escaped {
+			t.Errorf("textureEscape(%q) = %q, want %q", tt.raw, got, tt.escaped)
+		}
+
+		if got := textureUnescape(tt.escaped); got != tt.raw {
+			t.Errorf("textureUnescape(%q) = %q, want %q", tt.escaped, got, tt.raw)
+		}
+	}
+
+	// A trailing backslash doesn't escape anything.
+	if got := textureUnescape(`a\`); got != `a\` {
+		t.Errorf("textureUnescape(%q) = %q, want %q", `a\`, got, `a\`)
+	}
+}
+
+func TestTextureFiles(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"[png:iVBORw0KGgo", nil},
+		{"a.png^[colorize:red", []string{"a.png"}},
+		{"(a.png^b.png)^[mask:c.png", []string{"a.png", "b.png", "c.png"}},
+		{`[combine:2x1:0,0=a.png:1,0=b.png\^[mask\:c.png`, []string{"a.png", "b.png", "c.png"}},
+	}
+
+	for _, tt := range tests {
+		if got := textureFiles(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("textureFiles(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/HimbeerserverDE/mt"
+)
+
+// TransferPrefix is the prefix of chat messages and formspec names
+// that trusted servers can use to request a player transfer.
+// See doc/ctlchannel.md for details.
+const TransferPrefix = "mt_multiserver_proxy:"
+
+// transferChatMsg reports whether the chat message is a transfer
+// request and returns its kind and target.
+// Only raw and system messages without a sender are requests,
+// so that chat of players is never mistaken for one.
+func transferChatMsg(cmd *mt.ToCltChatMsg) (kind, target string, ok bool) {
+	if (cmd.Type != mt.RawMsg && cmd.Type != mt.SysMsg) || cmd.Sender != "" {
+		return "", "", false
+	}
+
+	if !strings.HasPrefix(cmd.Text, TransferPrefix) {
+		return "", "", false
+	}
+
+	kind, target, _ = strings.Cut(strings.TrimPrefix(cmd.Text, TransferPrefix), " ")
+	return kind, strings.TrimSpace(target), true
+}
+
+// transferFormspec reports whether the formspec is a transfer
+// request and returns its kind and target.
+func transferFormspec(cmd *mt.ToCltShowFormspec) (kind, target string, ok bool) {
+	if !strings.HasPrefix(cmd.Formname, TransferPrefix) {
+		return "", "", false
+	}
+
+	kind = strings.TrimPrefix(cmd.Formname, TransferPrefix)
+	return kind, strings.TrimSpace(cmd.Formspec), true
+}
+
+// trusted reports whether the upstream server may request transfers.
+// Transfer requests of other servers are passed to the client unchanged.
+func (sc *ServerConn) trusted() bool {
+	return Conf().Servers[sc.name].Trusted
+}
+
+// handleTransfer performs a transfer requested by the upstream server.
+// Requests from untrusted servers are ignored.
+// If the transfer fails the error is reported to the player
+// and to the server as a formspec submission.
+func (sc *ServerConn) handleTransfer(kind, target string) {
+	clt := sc.client()
+	if clt == nil {
+		return
+	}
+
+	if !sc.trusted() {
+		sc.Log("<-", "deny transfer from untrusted server")
+		return
+	}
+
+	sc.Log("<-", "transfer", kind, target)
+
+	var err error
+	switch kind {
+	case "hop":
+		err = clt.Hop(target)
+	case "hop_group":
+		err = clt.HopGroup(target)
+	default:
+		err = ErrUnknownCtlRequest
+	}
+
+	if err != nil {
+		clt.Log("<-", "transfer:", err)
+		clt.SendChatMsg("Could not switch servers. Error:", err.Error())
+
+		sc.SendCmd(&mt.ToSrvInvFields{
+			Formname: TransferPrefix + kind,
+			Fields: []mt.Field{
+				{Name: "target", Value: target},
+				{Name: "error", Value: err.Error()},
+			},
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"sort"
+	"strings"
+)
+
+// AddWhitelist adds a player to the whitelist.
+func AddWhitelist(name string) error {
+	return authIface.AddWhitelist(name)
+}
+
+// RmWhitelist removes a player from the whitelist.
+func RmWhitelist(name string) error {
+	return authIface.RmWhitelist(name)
+}
+
+// Whitelisted reports whether a player is allowed to join
+// while the whitelist is enabled. This is the case if the player
+// is on the whitelist or a member of one of the whitelisted
+// permission groups.
+// It does not take into account whether the whitelist is enabled.
+func Whitelisted(name string) bool {
+	conf := Conf()
+
+	for _, grp := range PlayerGroups(name) {
+		for _, wgrp := range conf.Whitelist.Groups {
+			if grp == wgrp {
+				return true
+			}
+		}
+	}
+
+	return authIface.Whitelisted(name)
+}
+
+// WhitelistEntries returns the names of all players on the whitelist.
+// Whitelisted permission groups are not included.
+func WhitelistEntries() ([]string, error) {
+	return authIface.ExportWhitelist()
+}
+
+func init() {
+	RegisterChatCmd(ChatCmd{
+		Name: "whitelist",
+		Perm: "cmd_whitelist",
+		Help: "Manage the whitelist.",
+		SubCmds: []ChatCmd{
+			{
+				Name: "add",
+				Help: "Add a player to the whitelist.",
+				Args: []ChatCmdArg{{Name: "name"}},
+				Handler: func(cc *ClientConn, args ...string) string {
+					if !playerNameChars.MatchString(args[0]) {
+						return "Invalid player name."
+					}
+
+					if err := AddWhitelist(args[0]); err != nil {
+						return "Could not add to whitelist. Error: " + err.Error()
+					}
+
+					return "Added " + args[0] + " to the whitelist."
+				},
+			},
+			{
+				Name: "rm",
+				Help: "Remove a player from the whitelist.",
+				Args: []ChatCmdArg{{Name: "name"}},
+				Handler: func(cc *ClientConn, args ...string) string {
+					if !playerNameChars.MatchString(args[0]) {
+						return "Invalid player name."
+					}
+
+					if err := RmWhitelist(args[0]); err != nil {
+						return "Could not remove from whitelist. Error: " + err.Error()
+					}
+
+					return "Removed " + args[0] + " from the whitelist."
+				},
+			},
+			{
+				Name: "list",
+				Help: "List the whitelisted players.",
+				Args: []ChatCmdArg{},
+				Handler: func(cc *ClientConn, args ...string) string {
+					names, err := WhitelistEntries()
+					if err != nil {
+						return "Could not read whitelist. Error: " + err.Error()
+					}
+
+					if len(names) == 0 {
+						return "The whitelist is empty."
+					}
+
+					sort.Strings(names)
+					return "Whitelist: " + strings.Join(names, ", ")
+				},
+			},
+		},
+	})
+}